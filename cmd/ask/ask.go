@@ -7,31 +7,32 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"crypto/sha256"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"iter"
 	"log/slog"
 	"maps"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/maruel/ask/internal"
+	"github.com/maruel/ask/pkg/ask"
 	"github.com/maruel/genai"
-	"github.com/maruel/genai/adapters"
-	"github.com/maruel/genai/httprecord"
 	"github.com/maruel/genai/providers"
-	"github.com/maruel/genai/subprocessrecord"
 	"github.com/maruel/genaitools/shelltool"
-	"github.com/maruel/roundtrippers"
 	"github.com/mattn/go-colorable"
+	"golang.org/x/sync/errgroup"
 	"golang.org/x/term"
-	"gopkg.in/dnaeon/go-vcr.v4/pkg/recorder"
 )
 
 type stringsFlag []string
@@ -45,93 +46,112 @@ func (s *stringsFlag) String() string {
 	return strings.Join([]string(*s), ", ")
 }
 
-func loadProvider(ctx context.Context, provider string, opts ...genai.ProviderOption) (genai.Provider, error) {
-	if provider == "" {
-		provs := providers.Available(ctx)
-		if len(provs) == 0 {
-			return nil, errors.New("no providers available, make sure to set an FOO_API_KEY env var or install pi/codex/opencode/claude")
-		}
-		// If there's only one, use it directly.
-		if len(provs) == 1 {
-			for name, cfg := range provs {
-				c, err := cfg.Factory(ctx, filterOpts(cfg.IsCLI, opts)...)
-				if err != nil {
-					return nil, fmt.Errorf("failed to connect to provider %q: %w", name, err)
-				}
-				return adapters.WrapReasoning(c), nil
-			}
-		}
-		// Prefer CLI-based providers, then first alphabetically.
-		order := append([]string{"pi", "codex", "opencode", "claudecode"}, slices.Sorted(maps.Keys(provs))...)
-		for _, name := range order {
-			cfg, ok := provs[name]
-			if !ok {
-				continue
-			}
-			c, err := cfg.Factory(ctx, filterOpts(cfg.IsCLI, opts)...)
-			if err != nil {
-				slog.Debug("provider skipped", "provider", name, "error", err)
-				continue
-			}
-			return adapters.WrapReasoning(c), nil
-		}
-		return nil, errors.New("no providers could be loaded with the given options")
-	}
-	cfg := providers.All[provider]
-	if cfg.Factory == nil {
-		return nil, fmt.Errorf("unknown provider %q", provider)
-	}
-	c, err := cfg.Factory(ctx, filterOpts(cfg.IsCLI, opts)...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to provider %q: %w", provider, err)
-	}
-	return adapters.WrapReasoning(c), nil
-}
-
-// filterOpts returns opts appropriate for the provider kind.
-// CLI providers use ProviderOptionStarterWrapper; HTTP providers use ProviderOptionTransportWrapper.
-func filterOpts(isCLI bool, opts []genai.ProviderOption) []genai.ProviderOption {
-	out := make([]genai.ProviderOption, 0, len(opts))
-	for _, o := range opts {
-		switch o.(type) {
-		case genai.ProviderOptionTransportWrapper:
-			if isCLI {
-				continue
-			}
-		case genai.ProviderOptionStarterWrapper:
-			if !isCLI {
-				continue
-			}
-		}
-		out = append(out, o)
-	}
-	return out
+// subcommands are the names of the subcommands, with the number of arguments naming them, e.g. 2 for
+// "ask rag index". Their flags follow.
+var subcommands = map[string]int{
+	"bench":      1,
+	"chat":       1,
+	"check":      1,
+	"embed":      1,
+	"export":     1,
+	"history":    1,
+	"map":        1,
+	"matrix":     1,
+	"ocr":        1,
+	"prompt":     2,
+	"rag":        2,
+	"search":     1,
+	"transcribe": 1,
 }
 
-const (
-	reset   = "\x1b[0m"
-	hiblack = "\x1b[90m"
-)
-
 func Main() error {
 	flag.CommandLine.SetOutput(colorable.NewColorableStderr())
 	ctx, stop := internal.Init()
 	defer stop()
 
+	// Registered before the subcommands so they apply to all of them.
+	flag.BoolVar(&jsonErrors, "json-errors", false, "on failure, print the error as a JSON object on stderr")
+	if err := loadEnvFromArgs(os.Args[1:]); err != nil {
+		return err
+	}
+	// The values are read by loadEnvFromArgs.
+	flag.String("env-file", "", "file with KEY=VALUE lines to load in the environment, e.g. API keys")
+	flag.Bool("env-override", false, "let -env-file override the environment variables already set")
+	// After -env-file, which can set TMPDIR, and before any tool runs, since it changes the environment.
+	tmp, err := ask.UsePrivateTempDir()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tmp.Close() }()
+	// After -env-file, which can set NO_COLOR.
+	if err := initColors(); err != nil {
+		return err
+	}
+	colorMode := colorFlag("auto")
+	flag.Var(&colorMode, "color", "colorize the output: always, never or auto when stdout or stderr is a terminal and $NO_COLOR is not set")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "bench":
+			return cmdBench(ctx, os.Args[2:])
+		case "chat":
+			return cmdChat(ctx, os.Args[2:])
+		case "check":
+			return cmdCheck(os.Args[2:])
+		case "embed":
+			return cmdEmbed(ctx, os.Args[2:])
+		case "export":
+			return cmdExport(os.Args[2:])
+		case "history":
+			return cmdHistory(os.Args[2:])
+		case "map":
+			return cmdMap(ctx, os.Args[2:])
+		case "matrix":
+			return cmdMatrix(ctx, os.Args[2:])
+		case "ocr":
+			return cmdOCR(ctx, os.Args[2:])
+		case "prompt":
+			return cmdPrompt(os.Args[2:])
+		case "rag":
+			return cmdRAG(ctx, os.Args[2:])
+		case "search":
+			return cmdSearch(ctx, os.Args[2:])
+		case "transcribe":
+			return cmdTranscribe(ctx, os.Args[2:])
+		}
+	}
+
 	flag.Usage = func() {
 		w := flag.CommandLine.Output()
-		_, _ = fmt.Fprintf(w, "Usage: %s [options] <prompt>\n\n", os.Args[0])
+		_, _ = fmt.Fprintf(w, "Usage: %s [options] <prompt>\n", os.Args[0])
+		_, _ = fmt.Fprintf(w, "       %s bench [options]\n", os.Args[0])
+		_, _ = fmt.Fprintf(w, "       %s chat [options]\n", os.Args[0])
+		_, _ = fmt.Fprintf(w, "       %s check -tools <tools.yaml>\n", os.Args[0])
+		_, _ = fmt.Fprintf(w, "       %s embed [options] <text>\n", os.Args[0])
+		_, _ = fmt.Fprintf(w, "       %s export [-o out.md] [-html] <session.json | name>\n", os.Args[0])
+		_, _ = fmt.Fprintf(w, "       %s history [-n 10]\n", os.Args[0])
+		_, _ = fmt.Fprintf(w, "       %s map [options] -f <prompts.jsonl>\n", os.Args[0])
+		_, _ = fmt.Fprintf(w, "       %s matrix [options] -providers <p1,p2> <prompt>\n", os.Args[0])
+		_, _ = fmt.Fprintf(w, "       %s ocr [options] -f <image>\n", os.Args[0])
+		_, _ = fmt.Fprintf(w, "       %s prompt list | save [-f file] <name> [text]\n", os.Args[0])
+		_, _ = fmt.Fprintf(w, "       %s rag index [options] <dir> | query [options] <question>\n", os.Args[0])
+		_, _ = fmt.Fprintf(w, "       %s search [options] -q <query> <files>\n", os.Args[0])
+		_, _ = fmt.Fprintf(w, "       %s transcribe [options] -f <audio>\n\n", os.Args[0])
 		flag.PrintDefaults()
 		_, _ = fmt.Fprintf(w, "\nInput methods:\n")
 		_, _ = fmt.Fprintf(w, "  - Prompt argument: ask \"your question\"\n")
 		_, _ = fmt.Fprintf(w, "  - Files: ask -f file.txt -f image.jpg \"your question\"\n")
+		_, _ = fmt.Fprintf(w, "  - Audio: ask -f recording.mp3 \"summarize this\"\n")
 		_, _ = fmt.Fprintf(w, "  - Stdin: cat file.txt | ask \"analyze this\"\n")
 		_, _ = fmt.Fprintf(w, "  - URLs: ask -f https://example.com/image.jpg \"what is this?\"\n")
 		_, _ = fmt.Fprintf(w, "\nOn macOS, or linux when bubblewrap (bwrap) is installed, tool calling is enabled with a read-only file system.\n")
 		_, _ = fmt.Fprintf(w, "\nEnvironment variables:\n")
 		_, _ = fmt.Fprintf(w, "  ASK_MODEL:         default value for -model\n")
+		_, _ = fmt.Fprintf(w, "  ASK_MODEL_ALIASES: comma separated name=model aliases accepted by -model\n")
+		_, _ = fmt.Fprintf(w, "  ASK_NO_HISTORY:    enables -no-history when set\n")
 		_, _ = fmt.Fprintf(w, "  ASK_PROVIDER:      default value for -provider\n")
 		_, _ = fmt.Fprintf(w, "  ASK_REMOTE:        default value for -remote\n")
+		_, _ = fmt.Fprintf(w, "  ASK_SAFE:          enables -safe when set\n")
+		_, _ = fmt.Fprintf(w, "  ASK_SAVE:          enables -save when set\n")
 		_, _ = fmt.Fprintf(w, "  ASK_SYSTEM_PROMPT: default value for -sys\n")
 		_, _ = fmt.Fprintf(w, "\nPerformance:\n")
 		_, _ = fmt.Fprintf(w, "  Model auto detection (%s, %s, %s) requires an HTTP request which will\n", genai.ModelCheap, genai.ModelGood, genai.ModelSOTA)
@@ -139,132 +159,380 @@ func Main() error {
 	}
 	// General.
 	versionFlag := flag.Bool("version", false, "print version and exit")
-	verbose := flag.Bool("v", false, "verbose logs about metadata and usage")
 	quiet := flag.Bool("q", false, "silence the thinking and citations")
-	record := flag.String("record", "", "record the HTTP requests in yaml files for inspection in the specified file.")
+	explain := flag.Bool("explain", false, "print the thinking after the answer instead of as it is streamed")
+	htmlOut := flag.Bool("html", false, "write the answer as sanitized HTML once complete; the rest of the output goes to stderr")
+	output := flag.String("o", "", "file to write the answer to once complete, without the reasoning nor the citations, while still printing it; with -html, the HTML answer instead of stdout")
+	appendOutput := flag.Bool("append-output", false, "append the answer to the -o file instead of overwriting it, to accumulate runs")
+	wrap := flag.Int("wrap", 0, "wrap the output at word boundaries to this width; -1 uses the terminal width; 0 disables wrapping")
+	statsLive := flag.Bool("stats-live", false, "show the elapsed time and the approximate tokens/s on stderr while streaming; only on a terminal")
+	firstLine := flag.Bool("first-line", false, "print only the first non-empty line of the answer, e.g. to extract a single value in a script; the answer is printed once complete")
+	trim := flag.Bool("trim", false, "collapse the consecutive blank lines outside code blocks and trim the whitespace around the answer; the answer is printed once complete")
+	grep := flag.String("grep", "", "print only the lines of the answer matching this regexp, before -first-line; the answer is printed once complete")
+	raw := flag.Bool("raw", false, "print the answer as generated instead of rendering its markdown on the terminal")
+	plain := flag.Bool("plain", false, "print only the answer on stdout, for scripts: implies -q, -no-newline and -no-tool-output-to-user, and the files written are listed on stderr")
+	noDecorate := flag.Bool("no-decorate", false, "print only the answer on stdout, without markdown rendering, and the reasoning, the tool calls, the citations and the files written on stderr, even on a terminal; this is the default when stdout is redirected")
+	noNewline := flag.Bool("no-newline", false, "do not add a trailing newline when the answer doesn't end with one, e.g. for $(ask ...)")
+	session := flag.String("session", "", "name of the conversation to continue and save, in ~/.local/share/ask/sessions")
+	export := flag.String("export", "", "write the conversation once complete to this file, as JSON if it ends with .json, markdown otherwise")
+	continueFlag := flag.Bool("continue", false, "continue the conversation saved last, or the -session if specified")
+	saveLast := flag.Bool("save", os.Getenv("ASK_SAVE") != "", "save the conversation, including the attached files, for -continue when -session is not specified")
+	noHistory := flag.Bool("no-history", os.Getenv("ASK_NO_HISTORY") != "", "do not log the prompt in the history printed by ask history")
+	fanoutFlag := flag.String("fanout", "", "comma separated provider:model pairs to send the prompt to concurrently, e.g. openai:gpt-4o-mini,anthropic:claude-haiku-4-5, printing the answers and a usage summary")
+	fanoutLayout := flag.String("fanout-layout", "labeled", "how -fanout prints the answers: labeled once each is complete, interleaved as the lines are streamed, or columns side by side")
+	samples := flag.Int("n", 1, "number of candidate answers to request concurrently, selecting one with -select")
+	selectMode := flag.String("select", "consensus", "how -n selects the answer: consensus picks the most frequent one, judge asks -judge-model to pick the best one")
+	judgeModel := flag.String("judge-model", string(genai.ModelCheap), "model of the provider picking the best answer with -select judge")
+	showCandidates := flag.Bool("show-candidates", false, "print all the candidate answers of -n before the selected one")
+	serveAddr := flag.String("serve", "", "answer the prompts POSTed as JSON to this address, e.g. :8080, streaming the replies as server-sent events; binds to localhost when the host is omitted")
 
 	// Provider.
-	provider := flag.String("p", "", "(alias for -provider)")
-	names := slices.Sorted(maps.Keys(providers.Available(ctx)))
-	flag.StringVar(provider, "provider", os.Getenv("ASK_PROVIDER"), "backend to use: "+strings.Join(names, ", "))
-	remote := flag.String("r", "", "(alias for -remote)")
-	flag.StringVar(remote, "remote", os.Getenv("ASK_REMOTE"), "URL to use to access the backend, useful for local model")
+	var pf providerFlags
+	pf.register(ctx)
+	ttft := flag.Duration("ttft-timeout", 0, "fail when the provider doesn't start streaming the reply within this duration, e.g. 10s; 0 disables it")
+
+	// Generation.
+	temperature := flag.Float64("temperature", 0, "sampling temperature, lower is more deterministic; 0 uses the provider's default")
+	topP := flag.Float64("top-p", 0, "nucleus sampling probability mass, between 0 and 1; 0 uses the provider's default")
+	seed := flag.Int64("seed", 0, "seed to get reproducible answers with the providers supporting it; 0 is random")
+	maxTokens := flag.Int64("max-tokens", 0, "maximum number of tokens to generate; 0 uses the provider's default")
+
+	// Cache.
+	useCache := flag.Bool("cache", false, "replay the answer to an identical request without tools from the cache; the answer is cached otherwise")
+	cacheTTL := flag.Duration("cache-ttl", 24*time.Hour, "maximum age of a cached answer with -cache")
+	noCache := flag.Bool("no-cache", false, "neither replay nor cache the answer, overriding -cache from a profile or the configuration file")
+
+	// Escalation.
+	escalate := flag.Bool("escalate", false, "when the answer matches -escalate-pattern, ask again a model of the next tier: CHEAP, GOOD then SOTA")
+	escalatePattern := flag.String("escalate-pattern", `(?i)\b(i[’']?m not (sure|certain)|i am not (sure|certain)|i don[’']?t know|i do not know|not enough information)\b`, "regexp flagging an unsure answer with -escalate")
 
 	// Commands.
 	listModels := flag.Bool("list-models", false, "list available models and exit")
+	listProviders := flag.Bool("list-providers", false, "list the known providers, whether they are available and what they need, then exit")
 
-	// Model and modalities.
-	modelHelp := fmt.Sprintf("model ID to use, %q or %q to automatically select worse/better models; defaults to a %q model",
-		genai.ModelCheap, genai.ModelSOTA, genai.ModelGood)
-	model := flag.String("m", "", "(alias for -model)")
-	flag.StringVar(model, "model", os.Getenv("ASK_MODEL"), modelHelp)
-	modHelp := fmt.Sprintf("comma separated output modalities: %q, %q, %q, %q", genai.ModalityText, genai.ModalityAudio, genai.ModalityImage, genai.ModalityVideo)
-	mod := flag.String("modality", "", modHelp)
+	// Image generation.
+	aspect := flag.String("aspect", "", "aspect ratio of generated images: 1:1, 4:3, 3:4, 16:9 or 9:16")
+	imageCount := flag.Int("image-count", 1, "number of images to generate; the request is repeated as needed")
+	stdoutDoc := flag.Bool("stdout-doc", false, "write the generated image or document to stdout instead of a file; the rest of the output goes to stderr")
+	first := flag.Bool("first", false, "with -stdout-doc, write the first document when the model generates many instead of failing")
+	maxImages := flag.Int("max-images", 0, "maximum number of generated files to save; 0 means unlimited")
+	maxConcurrentDocs := flag.Int("max-concurrent-docs", 4, "maximum number of generated files downloaded concurrently")
+	extractImagesFlag := flag.Bool("extract-images", false, "save the images embedded in the answer as markdown data URIs or URLs, referencing the saved files instead; the answer is printed once complete")
 
 	// Tools.
 	useShell := flag.Bool("shell", false, "enable shell tool")
-	useWeb := flag.Bool("web", false, "enable web search tool; may be costly")
+	useWeb := flag.Bool("web", false, "enable web search tool; may be costly; with the provider's web search, the answer is printed once complete to insert the [n] citation markers")
+	webMode := flag.String("web-mode", "auto", "how -web searches: native uses the provider's web search, tool lets the model use curl in the sandboxed shell, auto uses native when the model supports it")
+	outDir := flag.String("out-dir", "", "enable the write_file tool, letting the model create files in this directory")
+	force := flag.Bool("force", false, "allow the write_file tool to overwrite existing files")
+	chunkStrategy := flag.String("chunk-strategy", "refuse", "what to do when the text files exceed the context window of the model: refuse, truncate them, or map-reduce to summarize them in chunks first")
+	forceContext := flag.Bool("force-context", false, "send the request even when the prompt and the files are estimated to exceed the context window of the model")
+	toolsFile := flag.String("tools", "", "YAML file declaring custom tools running a command in the sandboxed shell")
+	safe := flag.Bool("safe", os.Getenv("ASK_SAFE") != "", "disable the tools that can run code or write files, overriding -shell and -out-dir; only -web is kept")
+	maxCost := flag.Float64("max-cost", 0, "budget in US dollars, e.g. 0.05: abort before sending when the prompt is estimated to cost more, and stop the tool calls once spent; 0 means unlimited")
+	showCost := flag.Bool("show-cost", false, "print the token usage and the estimated cost of each request on stderr, from a bundled price list")
+	checksum := flag.Bool("checksum", false, "print the SHA-256 of the answer and of each file written on stderr, in the sha256sum format, to compare runs")
+	retryRefusal := flag.Bool("retry-on-refusal", false, "when the model refuses to reply, retry once asking for a factual reply")
+	retryModality := flag.Bool("retry-modality", false, "when the model replies without the requested output modality, retry once with a more explicit instruction")
+	noToolOutput := flag.Bool("no-tool-output-to-user", false, "do not echo the tool calls and their results; they are still sent to the model and logged with -v")
+	tabular := flag.Bool("tabular", false, "send the .csv, .tsv and .xlsx files as markdown tables, for the models that don't support spreadsheets")
+	sheet := flag.String("sheet", "", "sheet of the .xlsx files to send with -tabular; defaults to the first one")
+	tabularMaxRows := flag.Int("tabular-max-rows", ask.DefaultTabularMaxRows, "maximum number of rows of each spreadsheet sent with -tabular; the rest is truncated")
+	noFence := flag.Bool("no-fence", false, "send the source code files as documents instead of as text in markdown code blocks tagged with their language")
+	maxTurns := flag.Int("max-turns", 20, "maximum number of requests sent while the model calls tools; 0 means unlimited")
+	abortOnToolError := flag.Bool("abort-on-tool-error", false, "fail when a command run by a tool fails instead of returning the error to the model, e.g. in CI")
 
 	// Inputs.
-	systemPrompt := flag.String("sys", os.Getenv("ASK_SYSTEM_PROMPT"), "system prompt to use")
+	var sysPrompts, sysFiles, savedPrompts stringsFlag
+	flag.Var(&sysPrompts, "sys", "system prompt to use; can be specified multiple times to join fragments with newlines; defaults to $ASK_SYSTEM_PROMPT")
+	flag.Var(&sysFiles, "sys-file", "file with a system prompt fragment, joined before the -sys ones; can be specified multiple times")
+	flag.Var(&savedPrompts, "prompt", "name of a system prompt fragment saved with ask prompt save, joined before the -sys-file ones; can be specified multiple times")
+	edit := flag.Bool("edit", false, "write the prompt in $VISUAL or $EDITOR, prefilled with the arguments; reads it from stdin when no editor is set")
+	locale := flag.String("locale", "", "tell the model the locale, e.g. fr-CA, the time zone and the current date by appending them to the system prompt; auto uses $LANG")
+	prepend := flag.String("prepend", "", "text to add before the prompt, e.g. context repeated on every call")
+	appendText := flag.String("append", "", "text to add after the prompt, e.g. \"Answer in one sentence.\"")
 	var files stringsFlag
-	flag.Var(&files, "f", "file(s) to analyze; it can be a text file, a PDF or an image; can be specified multiple times; can be an URL")
+	flag.Var(&files, "f", "file(s) to analyze; it can be a text file, a PDF or an image; can be specified multiple times; can be an URL; git:diff, git:staged or git:<revision> attach a git diff, git:tree the files tracked by git; a directory or a glob pattern like 'src/**/*.go' attaches the files found; append #caption to a path to describe it")
+	gitDiff := flag.Bool("git-diff", false, "attach the uncommitted changes; same as -f git:diff")
+	gitStaged := flag.Bool("git-staged", false, "attach the staged changes, e.g. to write a commit message; same as -f git:staged")
+	speakFlag := flag.Bool("speak", false, "read the answer aloud once complete and write the audio to a file, with the provider's text to speech or the local engine (say or espeak-ng)")
+	speakProviderFlag := flag.String("speak-provider", "", "provider generating the speech with -speak, \"local\" for the local engine; defaults to -provider, falling back to the local engine")
+	speakModel := flag.String("speak-model", "", "model generating the speech with -speak; defaults to the provider's automatic selection")
+	var mic micFlag
+	flag.Var(&mic, "mic", "record the question from the microphone and attach it as audio, until Enter is pressed, or -mic=N for N seconds; requires sox, ffmpeg or arecord and a model accepting audio")
+	ragName := flag.String("rag", "", "name of an index created with ask rag index; the excerpts the most relevant to the prompt are added to the system prompt")
+	ragK := flag.Int("rag-k", 5, "number of excerpts added with -rag")
+	gitTree := flag.Bool("git-tree", false, "attach the list of the files tracked by git; same as -f git:tree")
+	var ignore stringsFlag
+	flag.Var(&ignore, "ignore", "glob pattern of the files and directories to skip when -f is a directory or a glob pattern, e.g. '*_test.go' or vendor; can be specified multiple times")
+	maxFileSize := flag.Int64("max-file-size", ask.DefaultMaxFileSize, "size in bytes above which the files found when -f is a directory or a glob pattern are skipped")
+	pick := flag.Bool("pick", false, "when -f is a directory or a glob pattern and stdin is a terminal, select the files to attach among the ones found instead of attaching all of them")
+	redact := flag.Bool("redact", false, "replace API keys, tokens, private keys and email addresses in the text files and stdin with "+ask.RedactPlaceholder+" before sending them")
+	var redactPatterns stringsFlag
+	flag.Var(&redactPatterns, "redact-pattern", "additional regexp to redact with -redact; can be specified multiple times")
 
 	flag.Parse()
+	if err := applyCacheConfig(); err != nil {
+		return err
+	}
+	if err := applyProfile(pf.profile); err != nil {
+		return err
+	}
+	if *noCache {
+		*useCache = false
+	}
 	if *versionFlag {
 		fmt.Println(version())
 		return nil
 	}
-	if *verbose {
-		internal.Level.Set(slog.LevelDebug)
+	if *gitDiff {
+		files = append(files, "git:diff")
+	}
+	if *gitStaged {
+		files = append(files, "git:staged")
+	}
+	if *gitTree {
+		files = append(files, "git:tree")
 	}
-	if *record != "" {
-		// Strip known extensions; the base is used for both .yaml and .ndjson.
-		for _, ext := range []string{".yaml", ".ndjson"} {
-			*record = strings.TrimSuffix(*record, ext)
+	if *speakFlag && (*serveAddr != "" || *listModels || *fanoutFlag != "" || *samples > 1) {
+		return errors.New("cannot use -speak with -serve, -list-models, -fanout or -n")
+	}
+	if mic.set {
+		if *serveAddr != "" || *listModels {
+			return errors.New("cannot use -mic with -serve or -list-models")
+		}
+		if mic.d == 0 && stdinIsPiped() {
+			return errors.New("-mic without a duration requires stdin to be a terminal to stop the recording; use -mic=N to record N seconds")
 		}
 	}
-	var rr *recorder.Recorder
-	var errRR error
-	var sr *subprocessrecord.Recorder
-
-	// Load provider.
-	var provOpts []genai.ProviderOption
-	if *verbose || *record != "" {
-		// HTTP providers.
-		provOpts = append(provOpts, genai.ProviderOptionTransportWrapper(func(h http.RoundTripper) http.RoundTripper {
-			if *verbose {
-				h = &roundtrippers.Log{Transport: h, Logger: slog.Default()}
-			}
-			if *record != "" {
-				slog.Info("recording HTTP", "file", *record+".yaml")
-				rr, errRR = httprecord.New(*record, h)
-				h = rr
-			}
-			return h
-		}))
-		// CLI providers.
-		var wrappers []genai.ProviderOptionStarterWrapper
-		if *verbose {
-			wrappers = append(wrappers, func(inner genai.Starter) genai.Starter {
-				return func(ctx context.Context, args []string) (io.WriteCloser, io.ReadCloser, func() error, error) {
-					slog.Info("subprocess start", "args", args)
-					stdin, stdout, wait, err := inner(ctx, args)
-					if err != nil {
-						return nil, nil, nil, err
-					}
-					return stdin, &logReader{ReadCloser: stdout}, wait, nil
-				}
-			})
+	if *ragName != "" {
+		if *serveAddr != "" || *listModels {
+			return errors.New("cannot use -rag with -serve or -list-models")
 		}
-		if *record != "" {
-			var err error
-			sr, err = subprocessrecord.New(*record)
-			if err != nil {
-				return err
-			}
-			wrappers = append(wrappers, sr.Wrap)
+		if *ragK < 1 {
+			return errors.New("-rag-k must be at least 1")
 		}
-		provOpts = append(provOpts, genai.ProviderOptionStarterWrapper(func(s genai.Starter) genai.Starter {
-			for _, w := range wrappers {
-				s = w(s)
-			}
-			return s
-		}))
 	}
-	if *model != "" {
-		provOpts = append(provOpts, genai.ProviderOptionModel(*model))
+	if *imageCount < 1 {
+		return errors.New("-image-count must be at least 1")
+	}
+	if *maxImages < 0 {
+		return errors.New("-max-images must not be negative")
+	}
+	if *maxConcurrentDocs < 1 {
+		return errors.New("-max-concurrent-docs must be at least 1")
+	}
+	switch ask.ChunkStrategy(*chunkStrategy) {
+	case ask.ChunkRefuse, ask.ChunkTruncate, ask.ChunkMapReduce:
+	default:
+		return fmt.Errorf("-chunk-strategy must be refuse, truncate or map-reduce, got %q", *chunkStrategy)
 	}
-	if *remote != "" && !*listModels {
-		provOpts = append(provOpts, genai.ProviderOptionRemote(*remote))
+	if *maxTurns < 0 {
+		return errors.New("-max-turns must not be negative")
 	}
-	if *mod != "" {
-		parts := strings.Split(*mod, ",")
-		o := make(genai.Modalities, len(parts))
-		for i, p := range parts {
-			o[i] = genai.Modality(strings.TrimSpace(p))
+	if *maxFileSize < 1 {
+		return errors.New("-max-file-size must be positive")
+	}
+	// Without a terminal, all the files found are attached.
+	if *pick && term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stderr.Fd())) {
+		picked, err := pickFiles(os.Stdin, os.Stderr, files, ignore, *maxFileSize)
+		if err != nil {
+			return err
 		}
-		provOpts = append(provOpts, genai.ProviderOptionModalities(o))
+		if len(picked) == 0 && len(files) != 0 {
+			return errors.New("-pick: no file selected")
+		}
+		files = picked
+	}
+	if *topP < 0 || *topP > 1 {
+		return errors.New("-top-p must be between 0 and 1")
 	}
-	c, err := loadProvider(ctx, *provider, provOpts...)
+	if *temperature < 0 || *maxTokens < 0 || *maxCost < 0 {
+		return errors.New("-temperature, -max-tokens and -max-cost must not be negative")
+	}
+	if *appendOutput && *output == "" {
+		return errors.New("-append-output requires -o")
+	}
+	if *htmlOut && *imageCount > 1 {
+		return errors.New("cannot use -html with -image-count")
+	}
+	if *wrap == -1 {
+		// Stay disabled when stdout is not a terminal, so the output is safe to pipe.
+		*wrap = 0
+		if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+			*wrap = width
+		}
+	} else if *wrap < 0 {
+		return errors.New("-wrap must be -1, 0 or a width")
+	}
+	if *serveAddr != "" {
+		if len(flag.Args()) != 0 || *prepend != "" || *appendText != "" || *edit {
+			return errors.New("cannot use -serve with a prompt")
+		}
+		if *htmlOut || *stdoutDoc || *imageCount > 1 || *escalate {
+			return errors.New("cannot use -serve with -html, -stdout-doc, -image-count or -escalate")
+		}
+	}
+	if *first && !*stdoutDoc {
+		return errors.New("-first requires -stdout-doc")
+	}
+	if *stdoutDoc {
+		if *htmlOut {
+			return errors.New("cannot use -stdout-doc with -html")
+		}
+		if *imageCount > 1 {
+			return errors.New("cannot use -stdout-doc with -image-count")
+		}
+	}
+	switch *webMode {
+	case "auto", "native", "tool":
+	default:
+		return fmt.Errorf("invalid -web-mode %q, expected auto, native or tool", *webMode)
+	}
+	if *safe {
+		if *useWeb && *webMode == "tool" {
+			_, _ = fmt.Fprintf(os.Stderr, "warning: -safe disables -web-mode tool\n")
+		}
+		// The shell with network access can run code.
+		*webMode = "native"
+		if *useShell {
+			_, _ = fmt.Fprintf(os.Stderr, "warning: -safe disables -shell\n")
+			*useShell = false
+		}
+		if *outDir != "" {
+			_, _ = fmt.Fprintf(os.Stderr, "warning: -safe disables -out-dir\n")
+			*outDir = ""
+		}
+		if *toolsFile != "" {
+			_, _ = fmt.Fprintf(os.Stderr, "warning: -safe disables -tools\n")
+			*toolsFile = ""
+		}
+	}
+	systemPrompt, err := joinSystemPrompt(savedPrompts, sysFiles, sysPrompts)
 	if err != nil {
 		return err
 	}
-	slog.Info("loaded", "provider", c.Name(), "model", c.ModelID())
-	if rr != nil {
-		defer func() {
-			if err2 := rr.Stop(); err2 != nil {
-				slog.Error("failed to stop HTTP recorder", "error", err2)
+	if *locale != "" {
+		l := *locale
+		if l == "auto" {
+			if l = localeFromEnv(); l == "" {
+				return errors.New("-locale auto: LC_ALL, LC_MESSAGES and LANG are not set")
 			}
-		}()
+		}
+		systemPrompt = wrapPrompt("", systemPrompt, localePrompt(l, time.Now()))
 	}
-	if sr != nil {
-		defer func() {
-			if err2 := sr.Stop(); err2 != nil {
-				slog.Error("failed to stop subprocess recorder", "error", err2)
+	var redactREs []*regexp.Regexp
+	if *redact {
+		redactREs = slices.Clone(ask.RedactPatterns)
+		for _, p := range redactPatterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return fmt.Errorf("invalid -redact-pattern: %w", err)
 			}
-		}()
+			redactREs = append(redactREs, re)
+		}
+	} else if len(redactPatterns) != 0 {
+		return errors.New("-redact-pattern requires -redact")
+	}
+	var customTools []ask.CustomTool
+	if *toolsFile != "" {
+		var err error
+		if customTools, err = ask.LoadCustomTools(*toolsFile); err != nil {
+			return err
+		}
+	}
+	var imgOpt *genai.GenOptionImage
+	if *aspect != "" {
+		var err error
+		if imgOpt, err = parseAspect(*aspect); err != nil {
+			return err
+		}
+	}
+	if *listProviders {
+		if len(flag.Args()) != 0 {
+			return errors.New("cannot use -list-providers with arguments")
+		}
+		printProviders(ctx)
+		return nil
+	}
+	if *plain {
+		*quiet = true
+		*noNewline = true
+		*noToolOutput = true
+	}
+	if *tabularMaxRows < 1 {
+		return errors.New("-tabular-max-rows must be at least 1")
+	}
+	if *sheet != "" && !*tabular {
+		return errors.New("-sheet requires -tabular")
+	}
+	var grepRE *regexp.Regexp
+	if *grep != "" {
+		var err error
+		if grepRE, err = regexp.Compile(*grep); err != nil {
+			return fmt.Errorf("invalid -grep: %w", err)
+		}
+	}
+	var escalateRE *regexp.Regexp
+	var tiers []string
+	if *escalate {
+		// Start with the cheapest model unless specified otherwise.
+		switch genai.ProviderOptionModel(pf.model) {
+		case "", genai.ModelCheap:
+			pf.model = string(genai.ModelCheap)
+			tiers = []string{string(genai.ModelGood), string(genai.ModelSOTA)}
+		case genai.ModelGood:
+			tiers = []string{string(genai.ModelSOTA)}
+		default:
+			return fmt.Errorf("-escalate requires -model to be empty, %s or %s", genai.ModelCheap, genai.ModelGood)
+		}
+		var err error
+		if escalateRE, err = regexp.Compile(*escalatePattern); err != nil {
+			return fmt.Errorf("invalid -escalate-pattern: %w", err)
+		}
+	}
+	if *listModels {
+		// The remote is only used for generation.
+		pf.remote = ""
+	}
+	var targets []*fanoutTarget
+	if *fanoutFlag != "" {
+		if targets, err = parseFanout(*fanoutFlag); err != nil {
+			return err
+		}
+		switch *fanoutLayout {
+		case "labeled", "interleaved", "columns":
+		default:
+			return fmt.Errorf("-fanout-layout must be labeled, interleaved or columns, got %q", *fanoutLayout)
+		}
+		if *serveAddr != "" || *htmlOut || *stdoutDoc || *imageCount > 1 || *escalate || *listModels || *session != "" || *continueFlag || *export != "" {
+			return errors.New("cannot use -fanout with -serve, -html, -stdout-doc, -image-count, -escalate, -list-models, -session, -continue or -export")
+		}
+		if *samples > 1 {
+			return errors.New("cannot use -fanout with -n")
+		}
+		// The first target is loaded as the provider.
+		pf.provider = targets[0].provider
+		pf.model = targets[0].model
+	}
+	if *samples < 1 {
+		return errors.New("-n must be at least 1")
+	}
+	if *samples > 1 {
+		switch *selectMode {
+		case "consensus", "judge":
+		default:
+			return fmt.Errorf("-select must be consensus or judge, got %q", *selectMode)
+		}
+		if *serveAddr != "" || *htmlOut || *stdoutDoc || *imageCount > 1 || *escalate || *listModels || *session != "" || *continueFlag || *export != "" {
+			return errors.New("cannot use -n with -serve, -html, -stdout-doc, -image-count, -escalate, -list-models, -session, -continue or -export")
+		}
 	}
+	c, err := pf.load(ctx)
+	if err != nil {
+		return err
+	}
+	defer pf.close()
 
 	if *listModels {
 		if len(flag.Args()) != 0 {
@@ -273,7 +541,7 @@ func Main() error {
 		if len(files) != 0 {
 			return errors.New("cannot use -models with files")
 		}
-		if *systemPrompt != "" {
+		if systemPrompt != "" {
 			return errors.New("cannot use -models with system prompt")
 		}
 		if *useShell {
@@ -282,12 +550,213 @@ func Main() error {
 		if *useWeb {
 			return errors.New("cannot use -models with -web")
 		}
+		if *outDir != "" {
+			return errors.New("cannot use -models with -out-dir")
+		}
+		if *toolsFile != "" {
+			return errors.New("cannot use -models with -tools")
+		}
 		err = printModels(ctx, c)
+	} else if (imgOpt != nil || *imageCount > 1) && !slices.Contains(c.OutputModalities(), genai.ModalityImage) {
+		err = fmt.Errorf("-aspect and -image-count require a model generating images; %q doesn't", c.ModelID())
 	} else {
-		err = sendRequest(ctx, c, flag.Args(), files, *systemPrompt, *useShell, *useWeb, *quiet)
+		cacheDir := ""
+		if *useCache {
+			d, err2 := os.UserCacheDir()
+			if err2 != nil {
+				return err2
+			}
+			cacheDir = filepath.Join(d, "ask", "responses")
+		}
+		// wrapProvider is applied to every provider loaded.
+		wrapProvider := func(c genai.Provider) genai.Provider {
+			if *ttft > 0 {
+				c = &providerTTFT{Provider: c, d: *ttft}
+			}
+			if cacheDir != "" {
+				c = &providerCache{Provider: c, dir: cacheDir, ttl: *cacheTTL}
+			}
+			return c
+		}
+		c = wrapProvider(c)
+		webFetch := false
+		if *useWeb {
+			mode := *webMode
+			if mode == "auto" {
+				mode = "tool"
+				if ask.SupportsWebSearch(c) {
+					mode = "native"
+				}
+			}
+			slog.InfoContext(ctx, "web", "mode", mode)
+			webFetch = mode == "tool"
+		}
+		prompt := strings.Join(flag.Args(), " ")
+		stdinUsed := false
+		if *edit {
+			if prompt, stdinUsed, err = editPrompt(ctx, prompt); err != nil {
+				return err
+			}
+		}
+		if mic.set {
+			p, cleanup, err2 := recordMic(ctx, mic.d)
+			if err2 != nil {
+				return err2
+			}
+			defer cleanup()
+			files = append(files, p+"#recording of the user's spoken question")
+		}
+		if *ragName != "" {
+			if prompt == "" {
+				return errors.New("-rag requires the prompt as arguments to retrieve the relevant excerpts")
+			}
+			rc, err2 := ragContext(ctx, &pf, *ragName, prompt, *ragK)
+			if err2 != nil {
+				return err2
+			}
+			systemPrompt = wrapPrompt("", systemPrompt, rc)
+		}
+		ro := requestOptions{
+			Options: ask.Options{
+				Prompt:              wrapPrompt(*prepend, prompt, *appendText),
+				Files:               files,
+				Ignore:              ignore,
+				MaxFileSize:         *maxFileSize,
+				Tabular:             *tabular,
+				Sheet:               *sheet,
+				TabularMaxRows:      *tabularMaxRows,
+				Fence:               !*noFence,
+				Redact:              redactREs,
+				SystemPrompt:        systemPrompt,
+				Temperature:         *temperature,
+				TopP:                *topP,
+				MaxTokens:           *maxTokens,
+				Seed:                *seed,
+				MaxCost:             *maxCost,
+				IgnoreContextWindow: *forceContext,
+				ChunkStrategy:       ask.ChunkStrategy(*chunkStrategy),
+				Image:               imgOpt,
+				Shell:               *useShell,
+				Web:                 *useWeb && !webFetch,
+				WebFetch:            webFetch,
+				OutDir:              *outDir,
+				Force:               *force,
+				CustomTools:         customTools,
+				RetryModality:       *retryModality,
+				RetryRefusal:        *retryRefusal,
+				MaxTurns:            *maxTurns,
+				AbortOnToolError:    *abortOnToolError,
+			},
+			stdinUsed:         stdinUsed,
+			imageCount:        *imageCount,
+			maxImages:         *maxImages,
+			maxConcurrentDocs: *maxConcurrentDocs,
+			extractImages:     *extractImagesFlag,
+			trim:              *trim,
+			firstLine:         *firstLine,
+			grep:              grepRE,
+			statsLive:         *statsLive,
+			checksum:          *checksum,
+			showCost:          *showCost,
+			quiet:             *quiet,
+			explain:           *explain,
+			showToolOutput:    !*noToolOutput,
+			noNewline:         *noNewline,
+			noDecorate:        *noDecorate || *plain,
+			markdown:          !*raw && !*plain && !*noDecorate && !*htmlOut && !*stdoutDoc && term.IsTerminal(int(os.Stdout.Fd())),
+			wrap:              *wrap,
+			html:              *htmlOut,
+			stdoutDoc:         *stdoutDoc,
+			first:             *first,
+			output:            *output,
+			appendOutput:      *appendOutput,
+			escalate:          escalateRE,
+			tiers:             tiers,
+			loadModel: func(ctx context.Context, model string) (genai.Provider, error) {
+				c, err := pf.loadModel(ctx, model)
+				if err != nil {
+					return nil, err
+				}
+				return wrapProvider(c), nil
+			},
+		}
+		if *speakFlag {
+			var load func(ctx context.Context) (genai.Provider, error)
+			if *speakProviderFlag != "local" {
+				prov, _, _ := strings.Cut(cmp.Or(*speakProviderFlag, pf.provider, c.Name()), ",")
+				load = func(ctx context.Context) (genai.Provider, error) {
+					return pf.loadSpeech(ctx, prov, *speakModel)
+				}
+			}
+			ro.speak = func(ctx context.Context, answer string) error {
+				return speak(ctx, load, answer)
+			}
+		}
+		if *serveAddr != "" {
+			err = serve(ctx, *serveAddr, c, ro.Options)
+		} else if len(targets) != 0 {
+			load := func(ctx context.Context, provider, model string) (genai.Provider, error) {
+				c, err := pf.loadProviderModel(ctx, provider, model)
+				if err != nil {
+					return nil, err
+				}
+				return wrapProvider(c), nil
+			}
+			err = fanout(ctx, c, load, targets, ro.Options, *fanoutLayout, stdinUsed)
+		} else if *samples > 1 {
+			loadJudge := func(ctx context.Context) (genai.Provider, error) {
+				return ro.loadModel(ctx, *judgeModel)
+			}
+			err = bestOf(ctx, c, loadJudge, ro.Options, *samples, *selectMode, *showCandidates, stdinUsed)
+		} else {
+			// Without -session, the conversation is saved as the last one with -save.
+			name := *session
+			if name == "" && *continueFlag {
+				if name, err = latestSession(); err != nil {
+					return err
+				}
+				if name == "" {
+					return errors.New("-continue: no conversation was saved; use -save or -session")
+				}
+			}
+			if name != "" {
+				if ro.Messages, err = loadSession(name); err != nil {
+					return err
+				}
+				slog.InfoContext(ctx, "session", "name", name, "messages", len(ro.Messages))
+			} else if *saveLast {
+				name = lastSession
+			}
+			if !*noHistory && ro.Prompt != "" {
+				e := historyEntry{Time: time.Now().UTC(), Provider: c.Name(), Model: c.ModelID(), Prompt: ro.Prompt}
+				// The history is best effort.
+				if err2 := appendHistory(&e); err2 != nil {
+					slog.WarnContext(ctx, "history", "err", err2)
+				}
+			}
+			err = sendRequest(ctx, c, &ro)
+			if errors.Is(err, ask.ErrContextWindowExceeded) {
+				err = fmt.Errorf("%w; use fewer or smaller files, a model with a larger context, -chunk-strategy truncate or map-reduce, or -force-context to send it anyway", err)
+			}
+			if err == nil && name != "" && len(ro.messages) != 0 {
+				err = saveSession(name, ro.messages)
+			}
+			if err == nil && *export != "" {
+				// The cost is omitted when the price of the model is unknown.
+				costUSD, _ := ask.Cost(c.ModelID(), &ro.usage)
+				err = writeExport(*export, &exportedConversation{
+					Provider:     c.Name(),
+					Model:        c.ModelID(),
+					SystemPrompt: ro.SystemPrompt,
+					Messages:     ro.messages,
+					Usage:        ro.usage,
+					Cost:         costUSD,
+				})
+			}
+		}
 	}
-	if errRR != nil {
-		return errRR
+	if pf.errRR != nil {
+		return pf.errRR
 	}
 	return err
 }
@@ -305,171 +774,597 @@ func printModels(ctx context.Context, c genai.Provider) error {
 	return err
 }
 
-func sendRequest(ctx context.Context, c genai.Provider, args []string, files stringsFlag, systemPrompt string, useShell, useWeb, quiet bool) error {
-	// Process inputs
-	msgs := make(genai.Messages, 0, 1)
-	userMsg := genai.Message{}
-	if query := strings.Join(args, " "); query != "" {
-		userMsg.Requests = append(userMsg.Requests, genai.Request{Text: query})
-	}
-	var closers []io.Closer
-	defer func() {
-		for _, c := range closers {
-			_ = c.Close()
-		}
-	}()
-	for _, n := range files {
-		if strings.HasPrefix(n, "http://") || strings.HasPrefix(n, "https://") {
-			userMsg.Requests = append(userMsg.Requests, genai.Request{Doc: genai.Doc{URL: n}})
-			continue
+// printProviders prints the known providers, marking the one used when -provider is not specified.
+func printProviders(ctx context.Context) {
+	w := colorable.NewColorableStdout()
+	auto := ask.AutoOrder(ctx)
+	names := slices.Sorted(maps.Keys(providers.All))
+	width := 0
+	for _, name := range names {
+		width = max(width, len(name))
+	}
+	for _, name := range names {
+		mark := " "
+		if len(auto) != 0 && auto[0] == name {
+			mark = "*"
 		}
-		f, err := os.Open(n)
-		if err != nil {
-			return err
+		status := "missing  "
+		if slices.Contains(auto, name) {
+			status = "available"
 		}
-		closers = append(closers, f)
-		userMsg.Requests = append(userMsg.Requests, genai.Request{Doc: genai.Doc{Src: f}})
-	}
-	if !term.IsTerminal(int(os.Stdin.Fd())) {
-		userMsg.Requests = append(userMsg.Requests, genai.Request{Doc: genai.Doc{Src: os.Stdin}})
-	}
-	if len(userMsg.Requests) == 0 {
-		return errors.New("provide a prompt as an argument or input files")
-	}
-	msgs = append(msgs, userMsg)
-	var opts []genai.GenOption
-	if systemPrompt != "" {
-		opts = append(opts, &genai.GenOptionText{SystemPrompt: systemPrompt})
+		need := strings.ToUpper(name) + "_API_KEY"
+		if providers.All[name].IsCLI {
+			need = "CLI installed in PATH"
+		}
+		_, _ = fmt.Fprintf(w, "%s %-*s  %s  %s\n", mark, width, name, status, need)
 	}
+	_, _ = fmt.Fprintf(w, "\n* is used when -provider is not specified.\n")
+}
 
-	useTools := false
-	if useShell {
-		if o, err := shelltool.New(false); o != nil {
-			useTools = true
-			opts = append(opts, o)
-		} else {
+// requestOptions is the request to send and how to display its result.
+type requestOptions struct {
+	ask.Options
+	// stdinUsed is set when stdin was read as the prompt, so it is not sent as a document.
+	stdinUsed bool
+	// imageCount is the number of times the request is sent to generate multiple images.
+	imageCount int
+	// maxImages is the maximum number of files saved across all the requests; 0 means unlimited.
+	maxImages int
+	// saved is the number of files saved so far.
+	saved int
+	// maxConcurrentDocs is the number of generated files downloaded concurrently.
+	maxConcurrentDocs int
+	// escalate is set to ask again the models in tiers, in order, while the answer matches.
+	escalate  *regexp.Regexp
+	tiers     []string
+	loadModel func(ctx context.Context, model string) (genai.Provider, error)
+	// speak reads the answer aloud with -speak.
+	speak func(ctx context.Context, answer string) error
+
+	quiet          bool
+	explain        bool
+	showToolOutput bool
+	// noNewline is set to print the answer exactly as generated.
+	noNewline bool
+	// noDecorate is set to only print the answer on stdout, even on a terminal.
+	noDecorate bool
+	// markdown is set to render the markdown of the answer on the terminal.
+	markdown bool
+	// messages is the conversation of the last request, to save it with -session.
+	messages genai.Messages
+	usage    genai.Usage
+	// wrap is the width to wrap the output at; 0 disables wrapping.
+	wrap int
+	// html is set to write the answer as HTML to output, or stdout when empty.
+	html bool
+	// output is the file the answer is written to, appended when appendOutput is set.
+	output       string
+	appendOutput bool
+	// statsLive is set to show the elapsed time and the throughput on stderr while streaming.
+	statsLive bool
+	// showCost is set to print the token usage and the estimated cost.
+	showCost bool
+	// checksum is set to print the SHA-256 of the answer and of the files written.
+	checksum bool
+	// extractImages is set to save the images embedded in the answer as markdown.
+	extractImages bool
+	// trim is set to normalize the whitespace of the answer once complete.
+	trim bool
+	// firstLine and grep filter the lines of the answer once complete.
+	firstLine bool
+	grep      *regexp.Regexp
+	// stdoutDoc is set to write the generated document to stdout. Only the first one is written when first is
+	// set, otherwise generating many is an error.
+	stdoutDoc bool
+	first     bool
+}
+
+func sendRequest(ctx context.Context, c genai.Provider, ro *requestOptions) error {
+	ro.Provider = c
+	if ro.Shell {
+		if s, err := shelltool.New(false); s == nil {
 			fmt.Fprintf(os.Stderr, "warning: could not find sandbox: %v\n", err)
+			ro.Shell = false
 		}
 	}
-	if useWeb {
-		opts = append(opts, &genai.GenOptionWeb{Search: true})
+	if ro.WebFetch {
+		if s, err := shelltool.New(true); s == nil {
+			fmt.Fprintf(os.Stderr, "warning: could not find sandbox, using the provider's web search: %v\n", err)
+			ro.WebFetch = false
+			ro.Web = true
+		}
+	}
+	var stdin []byte
+	if !ro.stdinUsed && stdinIsPiped() {
+		// Buffer stdin so the request can be sent multiple times with -image-count.
+		var err error
+		if stdin, err = io.ReadAll(os.Stdin); err != nil {
+			return err
+		}
+	}
+	for range ro.imageCount {
+		if stdin != nil {
+			ro.Stdin = bytes.NewReader(stdin)
+		}
+		answer, err := execRequest(ctx, c, ro)
+		for err == nil && ro.escalate != nil && len(ro.tiers) != 0 && ro.escalate.MatchString(answer) {
+			model := ro.tiers[0]
+			ro.tiers = ro.tiers[1:]
+			slog.InfoContext(ctx, "escalate", "model", model)
+			_, _ = fmt.Fprintf(os.Stderr, "note: the answer looks unsure; asking a %s model\n", model)
+			if c, err = ro.loadModel(ctx, model); err != nil {
+				return err
+			}
+			ro.Provider = c
+			if stdin != nil {
+				ro.Stdin = bytes.NewReader(stdin)
+			}
+			answer, err = execRequest(ctx, c, ro)
+		}
+		if err != nil {
+			return err
+		}
+		if ro.speak != nil {
+			if err := ro.speak(ctx, answer); err != nil {
+				return err
+			}
+		}
 	}
-	return execRequest(ctx, c, msgs, opts, useTools, quiet)
+	return nil
 }
 
-func execRequest(ctx context.Context, c genai.Provider, msgs genai.Messages, opts []genai.GenOption, useTools, quiet bool) error {
+// execRequest sends the request, prints the reply and returns the answer.
+func execRequest(ctx context.Context, c genai.Provider, ro *requestOptions) (string, error) {
 	w := colorable.NewColorableStdout()
-	// Send request.
-	var fragments iter.Seq[genai.Reply]
-	var finishTools func() (genai.Messages, genai.Usage, error)
-	var finishStream func() (genai.Result, error)
-	if useTools {
-		fragments, finishTools = adapters.GenStreamWithToolCallLoop(ctx, c, msgs, opts...)
-	} else {
-		fragments, finishStream = c.GenStream(ctx, msgs, opts...)
+	if ro.html || ro.stdoutDoc {
+		// stdout only contains the HTML or the document.
+		w = colorable.NewColorableStderr()
+	}
+	var stats *liveStats
+	if ro.statsLive && term.IsTerminal(int(os.Stderr.Fd())) {
+		// With -html and -stdout-doc, w is stderr.
+		stats = newLiveStats(w, ro.html || ro.stdoutDoc || term.IsTerminal(int(os.Stdout.Fd())))
+		w = stats
+	}
+	var ww *wordWrapper
+	if ro.wrap > 0 {
+		ww = &wordWrapper{w: w, width: ro.wrap}
+		w = ww
+	}
+	// dw is where the decoration is written: the headers, the reasoning, the tool calls, the citations and the
+	// files written. It is stderr when stdout is redirected or with -no-decorate, so stdout only contains the
+	// answer, e.g. for ask ... | tee answer.md.
+	dw := w
+	split := !ro.html && !ro.stdoutDoc && (ro.noDecorate || !term.IsTerminal(int(os.Stdout.Fd())))
+	if split {
+		dw = colorable.NewColorableStderr()
+		if stats != nil {
+			dw = stats.decoration()
+		}
+	}
+	// info is where the files written are listed.
+	info := dw
+	// aw is where the answer is written.
+	aw := w
+	var md *mdRenderer
+	if ro.markdown {
+		// https://no-color.org/
+		md = &mdRenderer{w: w, highlight: colors, style: styleAnswer}
+		aw = md
 	}
 	mode := "text"
-	last := ""
-	// TODO: Another better form would be to keep track of the citations and print them at the bottom. That's
-	// what most web uis do. Please send a PR to do that.
-	for f := range fragments {
-		if f.Text != "" {
-			if mode != "text" {
-				mode = "text"
-				if !strings.HasSuffix(last, "\n\n") {
-					if !strings.HasSuffix(last, "\n") {
-						_, _ = io.WriteString(w, "\n")
-					}
-					_, _ = io.WriteString(w, "\n")
-				}
-				_, _ = io.WriteString(w, hiblack+"Answer: "+reset)
+	// last is the last text written to w and ld points to the last text written to dw.
+	last, lastDeco := "", ""
+	ld := &last
+	if split {
+		ld = &lastDeco
+	}
+	// section switches to mode m, printing a blank line and the header when it changes. The answer has no
+	// header when it is alone on stdout.
+	section := func(m, header string) {
+		if mode == m {
+			return
+		}
+		if md != nil {
+			_ = md.Flush()
+		}
+		mode = m
+		out, l := dw, ld
+		if m == "text" {
+			if split {
+				return
+			}
+			out, l = w, &last
+		}
+		if *l != "" && !strings.HasSuffix(*l, "\n\n") {
+			if !strings.HasSuffix(*l, "\n") {
+				_, _ = io.WriteString(out, "\n")
 			}
-			_, _ = io.WriteString(w, f.Text)
+			_, _ = io.WriteString(out, "\n")
+		}
+		_, _ = io.WriteString(out, styleDim+header+reset)
+	}
+	o := ro.Options
+	if ro.showToolOutput {
+		// The hooks are run synchronously, so it is safe to write to w from them.
+		o.OnToolCall = func(name, args string) {
+			section("tool", "Tool "+name+": ")
+			_, _ = fmt.Fprintf(dw, "%s\n", args)
+		}
+		o.OnToolResult = func(name, out string, err error) {
+			if err != nil {
+				out += "error: " + err.Error() + "\n"
+			}
+			_, _ = io.WriteString(dw, styleDim+out+reset)
+			*ld = out
+			// Force a new section for the next call.
+			mode = ""
+		}
+	}
+	// fn are the citations, printed as footnotes after the answer.
+	fn := footnotes{byteOffsets: c.Name() == "gemini"}
+	// reasoning is buffered with -explain.
+	var reasoning strings.Builder
+	// answer is buffered with -html since the conversion needs the whole document, with -extract-images to
+	// replace the images, with -trim, -first-line and -grep to process the lines, and with the web search of
+	// the provider to insert the citation markers, since their offsets are received once the cited text was
+	// streamed.
+	filter := ro.trim || ro.firstLine || ro.grep != nil
+	cite := ro.Web && !ro.quiet
+	var answer strings.Builder
+	o.OnFragment = func(f genai.Reply) {
+		if f.Text != "" && (ro.html || ro.extractImages || filter || cite) {
+			answer.WriteString(f.Text)
+			return
+		}
+		if f.Text != "" {
+			section("text", "Answer: ")
+			_, _ = io.WriteString(aw, f.Text)
 			last = f.Text
-			continue
+			return
 		}
-		if quiet {
-			continue
+		if ro.quiet {
+			return
+		}
+		if f.Reasoning != "" && ro.explain {
+			reasoning.WriteString(f.Reasoning)
+			return
 		}
 		if f.Reasoning != "" {
-			if mode != "thinking" {
-				mode = "thinking"
-				if last != "" && !strings.HasSuffix(last, "\n\n") {
-					if !strings.HasSuffix(last, "\n") {
-						_, _ = io.WriteString(w, "\n")
-					}
-					_, _ = io.WriteString(w, "\n")
-				}
-				_, _ = io.WriteString(w, hiblack+"Reasoning: "+reset)
-			}
-			_, _ = io.WriteString(w, f.Reasoning)
-			last = f.Reasoning
-			continue
+			section("thinking", "Reasoning: ")
+			_, _ = io.WriteString(dw, paint(styleReasoning, f.Reasoning))
+			*ld = f.Reasoning
+			return
 		}
 		if !f.Citation.IsZero() {
-			if mode != "citation" {
-				mode = "citation"
-				if last != "" && !strings.HasSuffix(last, "\n\n") {
-					if !strings.HasSuffix(last, "\n") {
-						_, _ = io.WriteString(w, "\n")
-					}
-					_, _ = io.WriteString(w, "\n")
-				}
-				_, _ = io.WriteString(w, hiblack+"Citation:\n"+reset)
-			}
-			for j := range f.Citation.Sources {
-				src := &f.Citation.Sources[j]
-				switch src.Type {
-				case genai.CitationWeb:
-					_, _ = fmt.Fprintf(w, "  - %s / %s\n", src.Title, src.URL)
-				case genai.CitationWebImage:
-					_, _ = fmt.Fprintf(w, "  - Image: %s\n", src.URL)
-				case genai.CitationWebQuery, genai.CitationDocument, genai.CitationTool:
-				default:
-				}
-			}
-			last = "\n"
-			continue
+			fn.add(&f.Citation)
 		}
 	}
-	if !strings.HasSuffix(last, "\n") {
+	res, err := ask.Run(ctx, o)
+	for _, warning := range res.Warnings {
+		_, _ = fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+	if answer.Len() != 0 && len(fn.marks) != 0 {
+		text := fn.insertMarkers(answer.String())
+		answer.Reset()
+		answer.WriteString(text)
+	}
+	if ro.extractImages && answer.Len() != 0 {
+		text := extractImages(ctx, answer.String(), info, ro)
+		answer.Reset()
+		answer.WriteString(text)
+	}
+	if filter && answer.Len() != 0 {
+		text := answer.String()
+		if ro.trim {
+			text = trimAnswer(text)
+		}
+		if ro.firstLine || ro.grep != nil {
+			text = filterLines(text, ro.grep, ro.firstLine)
+		}
+		answer.Reset()
+		answer.WriteString(text)
+	}
+	if (ro.extractImages || filter || cite) && !ro.html && answer.Len() != 0 {
+		section("text", "Answer: ")
+		_, _ = io.WriteString(aw, answer.String())
+		last = answer.String()
+	}
+	if len(fn.sources) != 0 {
+		section("citation", "Sources:\n")
+		fn.print(dw)
+		*ld = "\n"
+	}
+	if reasoning.Len() != 0 {
+		section("thinking", "Reasoning: ")
+		_, _ = io.WriteString(dw, paint(styleReasoning, reasoning.String()))
+		*ld = reasoning.String()
+	}
+	if md != nil {
+		_ = md.Flush()
+	}
+	if ww != nil {
+		_ = ww.Flush()
+	}
+	if stats != nil {
+		stats.Stop()
+	}
+	if !strings.HasSuffix(last, "\n") && (last != "" || !ro.html) && !ro.noNewline {
 		_, _ = io.WriteString(w, "\n")
 	}
+	if lastDeco != "" && !strings.HasSuffix(lastDeco, "\n") {
+		_, _ = io.WriteString(dw, "\n")
+	}
+	if ro.html && answer.Len() != 0 {
+		h := markdownToHTML(answer.String())
+		if ro.output == "" {
+			_, _ = io.WriteString(os.Stdout, h)
+		} else if err2 := writeOutput(ro.output, h, ro.appendOutput); err2 != nil {
+			return "", err2
+		}
+	} else if ro.output != "" {
+		// The answer is buffered when processed.
+		text := res.String()
+		if ro.extractImages || filter {
+			text = answer.String()
+		}
+		if text != "" {
+			if err2 := writeOutput(ro.output, text, ro.appendOutput); err2 != nil {
+				return "", err2
+			}
+		}
+	}
 
-	var err error
-	msg := genai.Message{}
-	var usage genai.Usage
-	if finishTools != nil {
-		msgs, usage, err = finishTools()
-		if len(msgs) != 0 {
-			msg = msgs[len(msgs)-1]
+	replies := res.Replies
+	if ro.stdoutDoc {
+		if err2 := writeDocToStdout(c, &res.Message, ro.first); err2 != nil {
+			return "", err2
 		}
-	} else {
-		var res genai.Result
-		res, err = finishStream()
-		msg = res.Message
-		usage = res.Usage
+		replies = nil
 	}
 	// Still process the files even if there was an error.
-	for i := range msg.Replies {
-		r := &msg.Replies[i]
+	var docs []*genai.Reply
+	skipped := 0
+	for i := range replies {
+		r := &replies[i]
 		if r.Doc.IsZero() {
 			continue
 		}
+		if ro.maxImages != 0 && ro.saved >= ro.maxImages {
+			skipped++
+			continue
+		}
+		ro.saved++
+		docs = append(docs, r)
+	}
+	// The image can be returned as an URL or inline, depending on the provider. Always save it since it won't
+	// be available for long. The files are written in order once downloaded, keeping the ones that succeeded.
+	data := make([][]byte, len(docs))
+	errs := make([]error, len(docs))
+	var eg errgroup.Group
+	eg.SetLimit(ro.maxConcurrentDocs)
+	for i, r := range docs {
+		eg.Go(func() error {
+			data[i], errs[i] = downloadDoc(c, r)
+			return nil
+		})
+	}
+	_ = eg.Wait()
+	for i, r := range docs {
+		if errs[i] != nil {
+			continue
+		}
 		n := findAvailable(r.Doc.GetFilename())
-		_, _ = fmt.Fprintf(w, "- Writing %s\n", n)
+		_, _ = fmt.Fprintf(info, "- Writing %s\n", n)
+		if errs[i] = os.WriteFile(n, data[i], 0o644); errs[i] != nil {
+			continue
+		}
+		if ro.checksum {
+			printChecksum(n, data[i])
+		}
+		if ro.Image != nil {
+			checkAspect(n, data[i], ro.Image)
+		}
+	}
+	if skipped != 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "note: skipped %d file(s) after reaching -max-images %d\n", skipped, ro.maxImages)
+	}
+	if err2 := errors.Join(errs...); err2 != nil {
+		return "", err2
+	}
+	if err != nil {
+		return "", err
+	}
+	ro.messages = res.Messages
+	ro.usage = res.Usage
+	if len(res.Missing) != 0 {
+		// The text explanation, if any, was printed above as the answer.
+		_, _ = fmt.Fprintf(os.Stderr, "note: the model didn't generate the requested %s\n", ask.ModalitiesNames(res.Missing))
+	}
+	if ro.checksum {
+		printChecksum("(answer)", []byte(res.String()))
+	}
+	if ro.showCost {
+		printCost(c.ModelID(), &res.Usage)
+	}
+	return res.String(), nil
+}
+
+// printChecksum prints the SHA-256 of b on stderr in the format of sha256sum.
+func printChecksum(name string, b []byte) {
+	_, _ = fmt.Fprintf(os.Stderr, "%x  %s\n", sha256.Sum256(b), name)
+}
+
+// writeOutput writes the answer to the file, ending it with a newline so the appended answers are separated.
+func writeOutput(path, text string, appendTo bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendTo {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	_, err = io.WriteString(f, text)
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
 
-		// The image can be returned as an URL or inline, depending on the provider. Always save it since it won't
-		// be available for long.
-		b, err2 := downloadDoc(c, r)
-		if err2 != nil {
-			return err2
+// printCost prints the token usage of a request and its estimated cost on stderr.
+func printCost(model string, u *genai.Usage) {
+	c := "unknown price for " + model
+	if usd, ok := ask.Cost(model, u); ok {
+		c = fmt.Sprintf("~$%.4f", usd)
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "usage: %d input tokens (%d cached), %d output tokens (%d reasoning), %s\n",
+		u.InputTokens, u.InputCachedTokens, u.OutputTokens, u.ReasoningTokens, c)
+}
+
+// filterLines returns the lines of s matching re, if set, then only the first non-empty one if firstLine is
+// set.
+func filterLines(s string, re *regexp.Regexp, firstLine bool) string {
+	var out []string
+	for l := range strings.Lines(s) {
+		if re != nil && !re.MatchString(strings.TrimSuffix(l, "\n")) {
+			continue
 		}
-		if err2 := os.WriteFile(n, b, 0o644); err2 != nil {
-			return err2
+		if firstLine {
+			if strings.TrimSpace(l) != "" {
+				return strings.TrimSpace(l) + "\n"
+			}
+			continue
 		}
+		out = append(out, l)
 	}
-	slog.Info("done", "usage", usage)
+	return strings.Join(out, "")
+}
+
+// trimAnswer collapses the consecutive blank lines outside the fenced code blocks of s and trims the
+// whitespace around it.
+func trimAnswer(s string) string {
+	var b strings.Builder
+	inCode := false
+	blank := false
+	for l := range strings.Lines(strings.TrimSpace(s)) {
+		t := strings.TrimSpace(l)
+		if strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~") {
+			inCode = !inCode
+		}
+		if !inCode && t == "" {
+			if blank {
+				continue
+			}
+			blank = true
+			b.WriteString("\n")
+			continue
+		}
+		blank = false
+		b.WriteString(l)
+	}
+	return b.String() + "\n"
+}
+
+// wrapPrompt returns the prompt between prepend and appendText, separated by blank lines.
+//
+// The documents are not affected.
+func wrapPrompt(prepend, prompt, appendText string) string {
+	var parts []string
+	for _, s := range []string{prepend, prompt, appendText} {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// joinSystemPrompt joins the -prompt saved prompts, the content of the -sys-file files then the -sys
+// fragments, in order, with newlines.
+//
+// $ASK_SYSTEM_PROMPT is used when -sys is not specified.
+func joinSystemPrompt(saved, files, prompts []string) (string, error) {
+	var parts []string
+	for _, n := range saved {
+		s, err := loadPrompt(n)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, s)
+	}
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, strings.TrimSpace(string(b)))
+	}
+	if len(prompts) == 0 {
+		if v := os.Getenv("ASK_SYSTEM_PROMPT"); v != "" {
+			prompts = []string{v}
+		}
+	}
+	parts = append(parts, prompts...)
+	return strings.Join(parts, "\n"), nil
+}
+
+// localePrompt returns the text appended to the system prompt by -locale.
+func localePrompt(locale string, now time.Time) string {
+	zone, _ := now.Zone()
+	if tz := os.Getenv("TZ"); tz != "" {
+		zone = tz
+	}
+	return fmt.Sprintf("The user's locale is %s and their time zone is %s (UTC%s). The current date and time is %s. Use the date, number and currency formats of this locale.",
+		locale, zone, now.Format("-07:00"), now.Format("Monday 2006-01-02 15:04"))
+}
+
+// localeFromEnv returns the POSIX locale of the user as a BCP 47 tag, e.g. "fr_CA.UTF-8" becomes "fr-CA".
+func localeFromEnv() string {
+	for _, k := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		v := os.Getenv(k)
+		v, _, _ = strings.Cut(v, ".")
+		v, _, _ = strings.Cut(v, "@")
+		if v != "" && v != "C" && v != "POSIX" {
+			return strings.ReplaceAll(v, "_", "-")
+		}
+	}
+	return ""
+}
+
+// isURL returns true when the -f argument is to be fetched by the provider instead of read locally.
+func isURL(n string) bool {
+	return strings.HasPrefix(n, "http://") || strings.HasPrefix(n, "https://")
+}
+
+// stdinIsPiped returns true when stdin is to be used as an input.
+func stdinIsPiped() bool {
+	return !term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// writeDocToStdout writes the document generated in msg to stdout.
+//
+// It fails when there are many documents, unless first is set.
+func writeDocToStdout(c genai.Provider, msg *genai.Message, first bool) error {
+	var docs []*genai.Reply
+	for i := range msg.Replies {
+		if !msg.Replies[i].Doc.IsZero() {
+			docs = append(docs, &msg.Replies[i])
+		}
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+	if len(docs) > 1 && !first {
+		return fmt.Errorf("the model generated %d documents; use -first to write only the first one", len(docs))
+	}
+	b, err := downloadDoc(c, docs[0])
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(b)
 	return err
 }
 
@@ -507,16 +1402,3 @@ func findAvailable(filename string) string {
 		}
 	}
 }
-
-// logReader wraps an io.ReadCloser and logs each chunk read from it.
-type logReader struct {
-	io.ReadCloser
-}
-
-func (l *logReader) Read(p []byte) (int, error) {
-	n, err := l.ReadCloser.Read(p)
-	if n > 0 {
-		slog.Debug("subprocess stdout", "data", strings.TrimRight(string(p[:n]), "\n"))
-	}
-	return n, err
-}
@@ -0,0 +1,162 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Subcommand bench measuring a provider's latency and throughput.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/maruel/genai"
+	"golang.org/x/sync/errgroup"
+)
+
+const benchPrompt = "Write a short story of about 200 words about a lighthouse keeper. Reply with only the story."
+
+// benchRun is the measurement of one request.
+type benchRun struct {
+	ttft   time.Duration
+	total  time.Duration
+	tokens int64
+}
+
+// tokensPerSecond is the generation throughput, excluding the time to first token.
+func (b *benchRun) tokensPerSecond() float64 {
+	d := b.total - b.ttft
+	if d <= 0 {
+		return 0
+	}
+	return float64(b.tokens) / d.Seconds()
+}
+
+func cmdBench(ctx context.Context, args []string) error {
+	var pf providerFlags
+	pf.register(ctx)
+	n := flag.Int("n", 5, "number of requests to send")
+	concurrency := flag.Int("concurrency", 1, "number of requests in flight; values above 1 may skew the latency")
+	prompt := flag.String("prompt", benchPrompt, "prompt to send")
+	_ = flag.CommandLine.Parse(args)
+	if err := applyProfile(pf.profile); err != nil {
+		return err
+	}
+	if flag.NArg() != 0 {
+		return errors.New("unexpected arguments")
+	}
+	if *n < 1 {
+		return errors.New("-n must be at least 1")
+	}
+	if *concurrency < 1 {
+		return errors.New("-concurrency must be at least 1")
+	}
+	c, err := pf.load(ctx)
+	if err != nil {
+		return err
+	}
+	defer pf.close()
+
+	msgs := genai.Messages{genai.NewTextMessage(*prompt)}
+	var mu sync.Mutex
+	var runs []benchRun
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(*concurrency)
+	for i := range *n {
+		eg.Go(func() error {
+			r, err := benchOnce(ctx, c, msgs)
+			if err != nil {
+				return fmt.Errorf("request #%d: %w", i, err)
+			}
+			mu.Lock()
+			runs = append(runs, r)
+			mu.Unlock()
+			_, _ = fmt.Fprintf(os.Stderr, ".")
+			return nil
+		})
+	}
+	err = eg.Wait()
+	_, _ = fmt.Fprintf(os.Stderr, "\n")
+	if err != nil {
+		return err
+	}
+	if pf.errRR != nil {
+		return pf.errRR
+	}
+	fmt.Printf("%s / %s: %d requests, concurrency %d\n\n", c.Name(), c.ModelID(), len(runs), *concurrency)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	_, _ = fmt.Fprintf(w, "\tmin\tp50\tp90\tmax\t\n")
+	printDurations := func(name string, get func(r *benchRun) time.Duration) {
+		v := make([]float64, len(runs))
+		for i := range runs {
+			v[i] = float64(get(&runs[i]))
+		}
+		p := percentiles(v)
+		_, _ = fmt.Fprintf(w, "%s\t", name)
+		for _, x := range p {
+			_, _ = fmt.Fprintf(w, "%s\t", time.Duration(x).Round(time.Millisecond))
+		}
+		_, _ = fmt.Fprintf(w, "\n")
+	}
+	printDurations("TTFT", func(r *benchRun) time.Duration { return r.ttft })
+	printDurations("Total", func(r *benchRun) time.Duration { return r.total })
+	v := make([]float64, len(runs))
+	for i := range runs {
+		v[i] = runs[i].tokensPerSecond()
+	}
+	_, _ = fmt.Fprintf(w, "Tokens/s\t")
+	for _, x := range percentiles(v) {
+		_, _ = fmt.Fprintf(w, "%.1f\t", x)
+	}
+	_, _ = fmt.Fprintf(w, "\n")
+	return w.Flush()
+}
+
+// benchOnce sends one streaming request and measures it.
+func benchOnce(ctx context.Context, c genai.Provider, msgs genai.Messages) (benchRun, error) {
+	var r benchRun
+	start := time.Now()
+	fragments, finish := c.GenStream(ctx, msgs)
+	var text strings.Builder
+	for f := range fragments {
+		if r.ttft == 0 && (f.Text != "" || f.Reasoning != "") {
+			r.ttft = time.Since(start)
+		}
+		text.WriteString(f.Text)
+		text.WriteString(f.Reasoning)
+	}
+	res, err := finish()
+	r.total = time.Since(start)
+	if err != nil {
+		return r, err
+	}
+	if r.ttft == 0 {
+		r.ttft = r.total
+	}
+	r.tokens = res.Usage.OutputTokens
+	if r.tokens == 0 {
+		// Some providers do not report usage when streaming; use the usual approximation of 4 characters per
+		// token.
+		r.tokens = int64(text.Len() / 4)
+	}
+	return r, nil
+}
+
+// percentiles returns the min, p50, p90 and max of v, using the nearest rank method.
+func percentiles(v []float64) [4]float64 {
+	slices.Sort(v)
+	rank := func(p float64) float64 {
+		i := int(math.Ceil(p * float64(len(v))))
+		return v[max(i-1, 0)]
+	}
+	return [4]float64{v[0], rank(0.5), rank(0.9), v[len(v)-1]}
+}
@@ -0,0 +1,233 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Caching of the replies to identical requests.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"iter"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/maruel/genai"
+)
+
+// cachedReply is the content of a cache entry.
+type cachedReply struct {
+	Reasoning string      `json:"reasoning,omitzero"`
+	Text      string      `json:"text"`
+	Usage     genai.Usage `json:"usage"`
+}
+
+// cacheConfig is the cache section of the configuration file, the defaults of -cache and -cache-ttl.
+type cacheConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	TTL     time.Duration `yaml:"ttl"`
+}
+
+// applyCacheConfig sets -cache and -cache-ttl from the configuration file when they were not specified on the
+// command line.
+//
+// It must be called before applyProfile so the profile takes precedence.
+func applyCacheConfig() error {
+	cfg, p, err := readConfig()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if cfg.Cache.TTL < 0 {
+		return fmt.Errorf("%s: cache: ttl must not be negative", p)
+	}
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	// The flags are not marked as set so applyProfile can override them.
+	if cfg.Cache.Enabled && !set["cache"] {
+		if err := flag.Lookup("cache").Value.Set("true"); err != nil {
+			return err
+		}
+	}
+	if cfg.Cache.TTL != 0 && !set["cache-ttl"] {
+		if err := flag.Lookup("cache-ttl").Value.Set(cfg.Cache.TTL.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// providerCache wraps a Provider to replay the reply to a request identical to a previous one.
+//
+// Only text replies are cached. Requests with tools are never cached, since the tools have side effects and
+// their results may change.
+type providerCache struct {
+	genai.Provider
+	dir string
+	ttl time.Duration
+}
+
+func (c *providerCache) GenSync(ctx context.Context, msgs genai.Messages, opts ...genai.GenOption) (genai.Result, error) {
+	p := c.path(msgs, opts)
+	if r, ok := c.load(ctx, p); ok {
+		return r.result(), nil
+	}
+	res, err := c.Provider.GenSync(ctx, msgs, opts...)
+	if err == nil {
+		c.store(ctx, p, &res)
+	}
+	return res, err
+}
+
+// GenStream replays a cached reply instantly as a single fragment per kind.
+func (c *providerCache) GenStream(ctx context.Context, msgs genai.Messages, opts ...genai.GenOption) (iter.Seq[genai.Reply], func() (genai.Result, error)) {
+	p := c.path(msgs, opts)
+	if r, ok := c.load(ctx, p); ok {
+		res := r.result()
+		return func(yield func(genai.Reply) bool) {
+				for _, f := range res.Replies {
+					if !yield(f) {
+						return
+					}
+				}
+			}, func() (genai.Result, error) {
+				return res, nil
+			}
+	}
+	fragments, finish := c.Provider.GenStream(ctx, msgs, opts...)
+	return fragments, func() (genai.Result, error) {
+		res, err := finish()
+		if err == nil {
+			c.store(ctx, p, &res)
+		}
+		return res, err
+	}
+}
+
+func (c *providerCache) Unwrap() genai.Provider {
+	return c.Provider
+}
+
+// path returns the cache entry for the request, or "" if the request cannot be cached.
+//
+// The key is the hash of the provider, the model, the messages including the content of the documents, and
+// the options.
+func (c *providerCache) path(msgs genai.Messages, opts []genai.GenOption) string {
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s\x00%s\x00", c.Name(), c.ModelID())
+	for i := range msgs {
+		if len(msgs[i].Replies) != 0 {
+			// Only the user's requests are supported.
+			return ""
+		}
+		for j := range msgs[i].Requests {
+			if !hashRequest(h, &msgs[i].Requests[j]) {
+				return ""
+			}
+		}
+	}
+	for _, o := range opts {
+		if _, ok := o.(*genai.GenOptionTools); ok {
+			return ""
+		}
+		b, err := json.Marshal(o)
+		if err != nil {
+			return ""
+		}
+		_, _ = fmt.Fprintf(h, "%T\x00%s\x00", o, b)
+	}
+	return filepath.Join(c.dir, hex.EncodeToString(h.Sum(nil))+".json")
+}
+
+// hashRequest adds the request to h, reading the document content and rewinding it.
+func hashRequest(h hash.Hash, r *genai.Request) bool {
+	_, _ = fmt.Fprintf(h, "%s\x00%s\x00%s\x00", r.Text, r.Doc.Filename, r.Doc.URL)
+	if r.Doc.Src == nil {
+		return true
+	}
+	s, ok := r.Doc.Src.(io.Seeker)
+	if !ok {
+		return false
+	}
+	if _, err := io.Copy(h, r.Doc.Src); err != nil {
+		return false
+	}
+	_, err := s.Seek(0, io.SeekStart)
+	return err == nil
+}
+
+func (c *providerCache) load(ctx context.Context, p string) (*cachedReply, bool) {
+	if p == "" {
+		return nil, false
+	}
+	fi, err := os.Stat(p)
+	if err != nil || time.Since(fi.ModTime()) > c.ttl {
+		return nil, false
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, false
+	}
+	r := &cachedReply{}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, false
+	}
+	slog.InfoContext(ctx, "cache", "hit", p)
+	_, _ = fmt.Fprintf(os.Stderr, "note: replayed the answer cached %s ago\n", time.Since(fi.ModTime()).Round(time.Second))
+	return r, true
+}
+
+// store saves the result when it only contains text.
+func (c *providerCache) store(ctx context.Context, p string, res *genai.Result) {
+	if p == "" {
+		return
+	}
+	r := cachedReply{Usage: res.Usage}
+	for i := range res.Replies {
+		f := &res.Replies[i]
+		if !f.Doc.IsZero() || !f.Citation.IsZero() {
+			return
+		}
+		r.Reasoning += f.Reasoning
+		r.Text += f.Text
+	}
+	if r.Text == "" {
+		return
+	}
+	b, err := json.Marshal(&r)
+	if err == nil {
+		err = os.MkdirAll(c.dir, 0o700)
+	}
+	if err == nil {
+		err = os.WriteFile(p, b, 0o600)
+	}
+	// The cache is best effort.
+	if err != nil {
+		slog.WarnContext(ctx, "cache", "path", p, "err", err)
+	}
+}
+
+// result returns the cached reply as returned by the provider.
+func (r *cachedReply) result() genai.Result {
+	res := genai.Result{Usage: r.Usage}
+	if r.Reasoning != "" {
+		res.Replies = append(res.Replies, genai.Reply{Reasoning: r.Reasoning})
+	}
+	res.Replies = append(res.Replies, genai.Reply{Text: r.Text})
+	return res
+}
@@ -0,0 +1,358 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Subcommand chat keeping the conversation across turns.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/maruel/ask/pkg/ask"
+	"github.com/maruel/genai"
+	"github.com/mattn/go-colorable"
+	"golang.org/x/term"
+)
+
+const chatHelp = `Enter submits the message. End a line with \ to continue on the next one, or paste between
+lines containing only """, or after /paste until a line containing only the -paste-end terminator or
+Ctrl-D. Commands: /reset forgets the conversation, /fork saves it as a branch to come back to, /branch <name>
+continues it in a new branch, /switch <name> changes branch, /branches lists them, /drop <name> deletes one,
+/exit or Ctrl-D quits.
+`
+
+// maxChatBranches is the maximum number of branches kept in memory, since each one holds a whole conversation.
+const maxChatBranches = 16
+
+// chatBranches are the conversations of a chat that share a common beginning.
+type chatBranches struct {
+	current  string
+	branches map[string]genai.Messages
+}
+
+func newChatBranches() *chatBranches {
+	return &chatBranches{current: "main", branches: map[string]genai.Messages{}}
+}
+
+// history returns the conversation of the current branch.
+func (b *chatBranches) history() genai.Messages {
+	return b.branches[b.current]
+}
+
+// setHistory replaces the conversation of the current branch.
+func (b *chatBranches) setHistory(msgs genai.Messages) {
+	// Clip so the branches sharing a beginning never append to the same array.
+	b.branches[b.current] = slices.Clip(msgs)
+}
+
+// run runs a branch command and returns the message to print, or false if s is not one.
+func (b *chatBranches) run(s string) (string, bool, error) {
+	cmd, name, _ := strings.Cut(s, " ")
+	name = strings.TrimSpace(name)
+	switch cmd {
+	case "/fork":
+		for i := 1; ; i++ {
+			name = "fork-" + strconv.Itoa(i)
+			if _, ok := b.branches[name]; !ok {
+				break
+			}
+		}
+		if err := b.add(name); err != nil {
+			return "", true, err
+		}
+		return fmt.Sprintf("Saved the conversation as the branch %s; /switch %s to come back to it.", name, name), true, nil
+	case "/branch":
+		if err := b.add(name); err != nil {
+			return "", true, err
+		}
+		b.current = name
+		return fmt.Sprintf("Continuing in the new branch %s.", name), true, nil
+	case "/switch":
+		if _, ok := b.branches[name]; !ok {
+			return "", true, fmt.Errorf("no branch %q; see /branches", name)
+		}
+		b.current = name
+		return fmt.Sprintf("Switched to the branch %s, %d turn(s).", name, countTurns(b.history())), true, nil
+	case "/drop":
+		if _, ok := b.branches[name]; !ok {
+			return "", true, fmt.Errorf("no branch %q; see /branches", name)
+		}
+		if name == b.current {
+			return "", true, errors.New("cannot drop the current branch; /switch to another one first")
+		}
+		delete(b.branches, name)
+		return fmt.Sprintf("Dropped the branch %s.", name), true, nil
+	case "/branches":
+		var lines []string
+		for _, n := range slices.Sorted(maps.Keys(b.branches)) {
+			mark := "  "
+			if n == b.current {
+				mark = "* "
+			}
+			lines = append(lines, fmt.Sprintf("%s%s: %d turn(s)", mark, n, countTurns(b.branches[n])))
+		}
+		return strings.Join(lines, "\n"), true, nil
+	}
+	return "", false, nil
+}
+
+// add copies the current conversation in a new branch.
+func (b *chatBranches) add(name string) error {
+	if name == "" || strings.ContainsFunc(name, unicode.IsSpace) {
+		return errors.New("specify a branch name without spaces")
+	}
+	if _, ok := b.branches[name]; ok {
+		return fmt.Errorf("branch %q already exists", name)
+	}
+	if len(b.branches) >= maxChatBranches {
+		return fmt.Errorf("at most %d branches are kept; /drop one first", maxChatBranches)
+	}
+	b.branches[name] = slices.Clip(b.history())
+	return nil
+}
+
+// countTurns returns the number of prompts of the user in the conversation, not counting the tool results.
+func countTurns(msgs genai.Messages) int {
+	n := 0
+	for i := range msgs {
+		if len(msgs[i].Requests) != 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// load loads the branches of the session.
+func (b *chatBranches) load(session string) error {
+	msgs, err := loadSession(session)
+	if err != nil {
+		return err
+	}
+	sb, err := loadBranches(session)
+	if err != nil {
+		return err
+	}
+	if sb != nil {
+		maps.Copy(b.branches, sb.Branches)
+		if sb.Current != "" {
+			b.current = sb.Current
+		}
+	}
+	b.branches[b.current] = msgs
+	return nil
+}
+
+// save saves the current branch as the session, and the other ones next to it.
+func (b *chatBranches) save(session string) error {
+	if err := saveSession(session, b.history()); err != nil {
+		return err
+	}
+	sb := sessionBranches{Current: b.current, Branches: maps.Clone(b.branches)}
+	delete(sb.Branches, b.current)
+	return saveBranches(session, &sb)
+}
+
+func cmdChat(ctx context.Context, args []string) error {
+	var pf providerFlags
+	pf.register(ctx)
+	var sysPrompts, sysFiles, savedPrompts stringsFlag
+	flag.Var(&sysPrompts, "sys", "system prompt to use; can be specified multiple times to join fragments with newlines; defaults to $ASK_SYSTEM_PROMPT")
+	flag.Var(&sysFiles, "sys-file", "file with a system prompt fragment, joined before the -sys ones; can be specified multiple times")
+	flag.Var(&savedPrompts, "prompt", "name of a system prompt fragment saved with ask prompt save, joined before the -sys-file ones; can be specified multiple times")
+	quiet := flag.Bool("q", false, "silence the thinking")
+	session := flag.String("session", "", "name of the conversation to continue and save after each turn, with its branches, in ~/.local/share/ask/sessions")
+	compact := flag.Int("compact", 0, "once the conversation exceeds this number of turns, summarize the oldest ones with a cheap model, keeping the last -compact-keep ones verbatim; 0 disables it")
+	compactTokens := flag.Int64("compact-tokens", 0, "also compact once a request used more than this number of input tokens; 0 disables it")
+	compactKeep := flag.Int("compact-keep", 2, "number of the last turns kept verbatim by -compact and -compact-tokens")
+	pasteEnd := flag.String("paste-end", ".", "line ending the text entered after /paste")
+	_ = flag.CommandLine.Parse(args)
+	if err := applyProfile(pf.profile); err != nil {
+		return err
+	}
+	if flag.NArg() != 0 {
+		return errors.New("unexpected arguments; type the messages once started")
+	}
+	if *compact < 0 || *compactTokens < 0 {
+		return errors.New("-compact and -compact-tokens cannot be negative")
+	}
+	if *compactKeep < 1 {
+		return errors.New("-compact-keep must be at least 1")
+	}
+	if *pasteEnd = strings.TrimSpace(*pasteEnd); *pasteEnd == "" {
+		return errors.New("-paste-end cannot be empty")
+	}
+	systemPrompt, err := joinSystemPrompt(savedPrompts, sysFiles, sysPrompts)
+	if err != nil {
+		return err
+	}
+	c, err := pf.load(ctx)
+	if err != nil {
+		return err
+	}
+	defer pf.close()
+
+	branches := newChatBranches()
+	if *session != "" {
+		if err := branches.load(*session); err != nil {
+			return err
+		}
+	}
+	interactive := term.IsTerminal(int(os.Stdin.Fd()))
+	if interactive {
+		_, _ = fmt.Fprintf(os.Stderr, "%sChatting with %s/%s. %s%s", styleDim, c.Name(), c.ModelID(), chatHelp, reset)
+		if n := countTurns(branches.history()); n != 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "%sContinuing the branch %s of the session %s, %d turn(s).%s\n", styleDim, branches.current, *session, n, reset)
+		}
+	}
+	w := colorable.NewColorableStdout()
+	in := bufio.NewReader(os.Stdin)
+	save := func() {
+		if *session == "" {
+			return
+		}
+		if err := branches.save(*session); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		}
+	}
+	// cheap is the model summarizing the conversation for -compact, loaded on first use.
+	var cheap genai.Provider
+	for {
+		prompt, err := readChatMessage(in, interactive, *pasteEnd)
+		if errors.Is(err, io.EOF) && prompt == "" {
+			return pf.errRR
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		switch prompt {
+		case "":
+			continue
+		case "/exit", "/quit":
+			return pf.errRR
+		case "/reset":
+			branches.setHistory(nil)
+			save()
+			_, _ = fmt.Fprintf(os.Stderr, "%sThe conversation was forgotten.%s\n", styleDim, reset)
+			continue
+		}
+		if msg, ok, err := branches.run(prompt); ok {
+			if err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				continue
+			}
+			save()
+			_, _ = fmt.Fprintf(os.Stderr, "%s%s%s\n", styleDim, msg, reset)
+			continue
+		}
+		thinking := false
+		res, err := ask.Run(ctx, ask.Options{
+			Provider:     c,
+			Messages:     branches.history(),
+			Prompt:       prompt,
+			SystemPrompt: systemPrompt,
+			OnFragment: func(f genai.Reply) {
+				if f.Reasoning != "" && !*quiet {
+					if !thinking {
+						_, _ = io.WriteString(w, styleDim)
+						thinking = true
+					}
+					_, _ = io.WriteString(w, f.Reasoning)
+				}
+				if f.Text != "" {
+					if thinking {
+						_, _ = io.WriteString(w, reset+"\n\n")
+						thinking = false
+					}
+					_, _ = io.WriteString(w, f.Text)
+				}
+			},
+		})
+		if thinking {
+			_, _ = io.WriteString(w, reset)
+		}
+		_, _ = io.WriteString(w, "\n")
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			// The turn is not kept so it can be retried.
+			_, _ = fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			continue
+		}
+		branches.setHistory(append(branches.history(), genai.NewTextMessage(prompt), res.Message))
+		n := countTurns(branches.history())
+		if n > *compactKeep && ((*compact != 0 && n > *compact) || (*compactTokens != 0 && res.Usage.InputTokens+res.Usage.InputCachedTokens > *compactTokens)) {
+			if cheap == nil {
+				if cheap, err = pf.loadModel(ctx, string(genai.ModelCheap)); err != nil {
+					return err
+				}
+			}
+			// The conversation is kept as is on failure, to try again on the next turn.
+			if msgs, err := compactHistory(ctx, cheap, branches.history(), *compactKeep); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "error: compacting the conversation: %v\n", err)
+			} else {
+				branches.setHistory(msgs)
+				_, _ = fmt.Fprintf(os.Stderr, "%sSummarized the %d oldest turns.%s\n", styleDim, n-*compactKeep, reset)
+			}
+		}
+		save()
+	}
+}
+
+// readChatMessage reads a message, which can span multiple lines.
+//
+// A line ending with a backslash continues on the next line. Lines between two lines containing only """ are
+// read as is, which is convenient to paste code or logs, as are the lines after a /paste line until one
+// containing only pasteEnd or the end of the input.
+func readChatMessage(in *bufio.Reader, interactive bool, pasteEnd string) (string, error) {
+	var lines []string
+	// end is the line ending the block being read as is, if any.
+	end := ""
+	for {
+		if interactive {
+			p := "> "
+			if end != "" || len(lines) != 0 {
+				p = ". "
+			}
+			_, _ = fmt.Fprintf(os.Stderr, "%s%s%s", styleDim, p, reset)
+		}
+		l, err := in.ReadString('\n')
+		l = strings.TrimRight(l, "\r\n")
+		if err != nil {
+			if l != "" {
+				lines = append(lines, l)
+			}
+			return strings.TrimSpace(strings.Join(lines, "\n")), err
+		}
+		switch {
+		case end != "" && strings.TrimSpace(l) == end:
+			return strings.TrimSpace(strings.Join(lines, "\n")), nil
+		case end != "":
+			lines = append(lines, l)
+		case strings.TrimSpace(l) == `"""`:
+			end = `"""`
+		case len(lines) == 0 && strings.TrimSpace(l) == "/paste":
+			end = pasteEnd
+			if interactive {
+				_, _ = fmt.Fprintf(os.Stderr, "%sEnd with a line containing only %s or with Ctrl-D.%s\n", styleDim, pasteEnd, reset)
+			}
+		case strings.HasSuffix(l, `\`):
+			lines = append(lines, strings.TrimSuffix(l, `\`))
+		default:
+			lines = append(lines, l)
+			return strings.TrimSpace(strings.Join(lines, "\n")), nil
+		}
+	}
+}
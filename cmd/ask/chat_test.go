@@ -0,0 +1,134 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Tests of the chat input and branches.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/maruel/genai"
+)
+
+func TestReadChatMessage(t *testing.T) {
+	data := []struct {
+		in   string
+		want []string
+	}{
+		{"a\nb\n", []string{"a", "b"}},
+		{"a \\\nb\n", []string{"a \nb"}},
+		{"\"\"\"\na\n\n.\n\"\"\"\nb\n", []string{"a\n\n.", "b"}},
+		{"/paste\na\n\"\"\"\n\n.\nb\n", []string{"a\n\"\"\"", "b"}},
+		// The end of the input ends the paste.
+		{"/paste\na\nb", []string{"a\nb"}},
+		// /paste is only a command at the start of a message.
+		{"a \\\n/paste\n", []string{"a \n/paste"}},
+	}
+	for _, line := range data {
+		in := bufio.NewReader(strings.NewReader(line.in))
+		var got []string
+		for {
+			s, err := readChatMessage(in, false, ".")
+			if s != "" {
+				got = append(got, s)
+			}
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !slices.Equal(got, line.want) {
+			t.Errorf("%q: got %q, want %q", line.in, got, line.want)
+		}
+	}
+	// A custom terminator.
+	s, err := readChatMessage(bufio.NewReader(strings.NewReader("/paste\n.\nEOF\n")), false, "EOF")
+	if s != "." || err != nil {
+		t.Fatalf("got %q, %v", s, err)
+	}
+}
+
+func TestChatBranches(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	turn := func(prompt string) genai.Messages {
+		return genai.Messages{genai.NewTextMessage(prompt), {Replies: []genai.Reply{{Text: "reply to " + prompt}}}}
+	}
+	run := func(b *chatBranches, cmd string) string {
+		t.Helper()
+		msg, ok, err := b.run(cmd)
+		if !ok || err != nil {
+			t.Fatalf("%s: %t, %v", cmd, ok, err)
+		}
+		return msg
+	}
+	b := newChatBranches()
+	b.setHistory(turn("common"))
+	run(b, "/fork")
+	run(b, "/branch alt")
+	b.setHistory(append(b.history(), turn("alternative")...))
+	run(b, "/switch main")
+	b.setHistory(append(b.history(), turn("original")...))
+	if got := countTurns(b.branches["fork-1"]); got != 1 {
+		t.Fatalf("fork-1 has %d turns", got)
+	}
+	if got := b.branches["alt"][2].Requests[0].Text; got != "alternative" {
+		t.Fatalf("alt continues with %q", got)
+	}
+	if got := b.branches["main"][2].Requests[0].Text; got != "original" {
+		t.Fatalf("main continues with %q", got)
+	}
+	want := "  alt: 2 turn(s)\n  fork-1: 1 turn(s)\n* main: 2 turn(s)"
+	if got := run(b, "/branches"); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for _, cmd := range []string{"/branch alt", "/switch missing", "/drop main", "/branch"} {
+		if _, ok, err := b.run(cmd); !ok || err == nil {
+			t.Fatalf("%s: expected an error", cmd)
+		}
+	}
+	if _, ok, _ := b.run("/unknown"); ok {
+		t.Fatal("/unknown is not a branch command")
+	}
+
+	// The current branch is the session, so ask -session continues it.
+	run(b, "/switch alt")
+	if err := b.save("s"); err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := loadSession("s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 4 || msgs[2].Requests[0].Text != "alternative" {
+		t.Fatalf("unexpected session %v", msgs)
+	}
+	if name, err := latestSession(); err != nil || name != "s" {
+		t.Fatalf("latest session is %q, %v", name, err)
+	}
+	b2 := newChatBranches()
+	if err := b2.load("s"); err != nil {
+		t.Fatal(err)
+	}
+	if got := run(b2, "/branches"); got != strings.Replace(strings.Replace(want, "* main", "  main", 1), "  alt", "* alt", 1) {
+		t.Fatalf("reloaded %q", got)
+	}
+
+	// The branches are bounded.
+	for len(b.branches) < maxChatBranches {
+		run(b, "/fork")
+	}
+	if _, _, err := b.run("/fork"); err == nil {
+		t.Fatal("expected the number of branches to be bounded")
+	}
+	run(b, "/drop fork-1")
+	run(b, "/fork")
+}
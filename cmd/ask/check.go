@@ -0,0 +1,37 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Subcommand check validating the configuration files without calling a provider.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/maruel/ask/pkg/ask"
+)
+
+func cmdCheck(args []string) error {
+	toolsFile := flag.String("tools", "", "YAML file declaring custom tools, as used with ask -tools")
+	_ = flag.CommandLine.Parse(args)
+	if flag.NArg() != 0 {
+		return errors.New("unexpected arguments")
+	}
+	if *toolsFile == "" {
+		return errors.New("-tools is required")
+	}
+	// LoadCustomTools validates the schemas and expands the command templates, so a tool that loads cannot
+	// fail because of its declaration when called.
+	tools, err := ask.LoadCustomTools(*toolsFile)
+	if err != nil {
+		return err
+	}
+	for i := range tools {
+		fmt.Printf("- %s\n", tools[i].Name())
+	}
+	fmt.Printf("%s: %d tools ok\n", *toolsFile, len(tools))
+	return nil
+}
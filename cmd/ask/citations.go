@@ -0,0 +1,152 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Citations collected while streaming and printed as numbered footnotes after the answer.
+
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/maruel/genai"
+)
+
+// footnotes are the deduplicated sources cited in the answer, numbered from 1 in the order they are cited.
+type footnotes struct {
+	sources []genai.CitationSource
+	// index maps the key of a source to its position in sources.
+	index map[string]int
+	// marks are the positions in the answer where the provider supplied the offsets of the cited text.
+	marks []footnoteMark
+	// byteOffsets is set when the provider's offsets are in bytes instead of runes, like Gemini's.
+	byteOffsets bool
+}
+
+// footnoteMark is the position where the footnotes numbers are inserted in the answer.
+type footnoteMark struct {
+	end     int64
+	numbers []int
+}
+
+// add records the sources of the citation and returns their footnote numbers.
+func (fn *footnotes) add(c *genai.Citation) []int {
+	var numbers []int
+	for i := range c.Sources {
+		src := &c.Sources[i]
+		var key string
+		switch src.Type {
+		case genai.CitationWeb, genai.CitationWebImage:
+			key = src.URL
+		case genai.CitationDocument:
+			key = "doc:" + src.ID + ":" + src.Title
+		case genai.CitationWebQuery, genai.CitationTool:
+			// The search queries and the tool calls are not sources.
+			continue
+		default:
+			continue
+		}
+		if key == "" {
+			continue
+		}
+		j, ok := fn.index[key]
+		if !ok {
+			if fn.index == nil {
+				fn.index = map[string]int{}
+			}
+			j = len(fn.sources)
+			fn.index[key] = j
+			fn.sources = append(fn.sources, *src)
+		}
+		if !slices.Contains(numbers, j+1) {
+			numbers = append(numbers, j+1)
+		}
+	}
+	if c.EndIndex > 0 && len(numbers) != 0 {
+		fn.marks = append(fn.marks, footnoteMark{end: c.EndIndex, numbers: numbers})
+	}
+	return numbers
+}
+
+// insertMarkers inserts the [n] markers at the end of the cited text in the answer.
+//
+// The offsets refer to the whole answer so it must be complete. The markers beyond the end of the answer are
+// skipped.
+func (fn *footnotes) insertMarkers(text string) string {
+	if len(fn.marks) == 0 {
+		return text
+	}
+	// Convert the offsets to bytes. A byte offset in the middle of a character is moved after it.
+	marks := make([]footnoteMark, 0, len(fn.marks))
+	for _, m := range fn.marks {
+		end := m.end
+		if fn.byteOffsets {
+			for end < int64(len(text)) && !utf8.RuneStart(text[end]) {
+				end++
+			}
+		} else {
+			end = runeOffset(text, end)
+		}
+		if end <= int64(len(text)) {
+			marks = append(marks, footnoteMark{end: end, numbers: m.numbers})
+		}
+	}
+	slices.SortStableFunc(marks, func(a, b footnoteMark) int {
+		return cmp.Compare(a.end, b.end)
+	})
+	var b strings.Builder
+	prev := int64(0)
+	for _, m := range marks {
+		b.WriteString(text[prev:m.end])
+		for _, n := range m.numbers {
+			b.WriteString("[" + strconv.Itoa(n) + "]")
+		}
+		prev = m.end
+	}
+	b.WriteString(text[prev:])
+	return b.String()
+}
+
+// runeOffset returns the offset in bytes of the n-th rune of text, or a value past the end when there are
+// fewer runes.
+func runeOffset(text string, n int64) int64 {
+	i := int64(0)
+	for off := range text {
+		if i == n {
+			return int64(off)
+		}
+		i++
+	}
+	if i == n {
+		return int64(len(text))
+	}
+	return int64(len(text)) + 1
+}
+
+// print prints the numbered sources.
+func (fn *footnotes) print(w io.Writer) {
+	for i := range fn.sources {
+		src := &fn.sources[i]
+		var l string
+		switch src.Type {
+		case genai.CitationWeb:
+			l = src.URL
+			if src.Title != "" && src.Title != src.URL {
+				l = src.Title + ": " + src.URL
+			}
+		case genai.CitationWebImage:
+			l = "Image: " + src.URL
+		case genai.CitationDocument:
+			l = "Document: " + cmp.Or(src.Title, src.ID)
+		case genai.CitationWebQuery, genai.CitationTool:
+		default:
+		}
+		_, _ = fmt.Fprintf(w, "%s\n", paint(styleCitation, fmt.Sprintf("[%d] %s", i+1, l)))
+	}
+}
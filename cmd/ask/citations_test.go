@@ -0,0 +1,74 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Tests of the citation markers inserted in the answer.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/maruel/genai"
+)
+
+func TestInsertMarkers(t *testing.T) {
+	src := func(url string) []genai.CitationSource {
+		return []genai.CitationSource{{Type: genai.CitationWeb, URL: url}}
+	}
+	// "Café" is 4 runes and 5 bytes; "über" is 4 runes and 5 bytes.
+	const text = "Café au lait. Ça va über bien."
+	data := []struct {
+		name        string
+		byteOffsets bool
+		citations   []genai.Citation
+		want        string
+	}{
+		{
+			name: "runes",
+			citations: []genai.Citation{
+				{StartIndex: 0, EndIndex: 13, Sources: src("https://a")},
+				{StartIndex: 14, EndIndex: 30, Sources: src("https://b")},
+			},
+			want: "Café au lait.[1] Ça va über bien.[2]",
+		},
+		{
+			name:        "bytes",
+			byteOffsets: true,
+			citations: []genai.Citation{
+				{StartIndex: 0, EndIndex: 14, Sources: src("https://a")},
+				{StartIndex: 15, EndIndex: 33, Sources: src("https://b")},
+			},
+			want: "Café au lait.[1] Ça va über bien.[2]",
+		},
+		{
+			name:        "bytes_mid_rune",
+			byteOffsets: true,
+			citations: []genai.Citation{
+				// In the middle of é.
+				{StartIndex: 0, EndIndex: 4, Sources: src("https://a")},
+			},
+			want: "Café[1] au lait. Ça va über bien.",
+		},
+		{
+			name: "same_source_past_end",
+			citations: []genai.Citation{
+				{StartIndex: 0, EndIndex: 4, Sources: src("https://a")},
+				{StartIndex: 14, EndIndex: 16, Sources: src("https://a")},
+				{StartIndex: 0, EndIndex: 31, Sources: src("https://b")},
+			},
+			want: "Café[1] au lait. Ça[1] va über bien.",
+		},
+	}
+	for _, l := range data {
+		t.Run(l.name, func(t *testing.T) {
+			fn := footnotes{byteOffsets: l.byteOffsets}
+			for i := range l.citations {
+				fn.add(&l.citations[i])
+			}
+			if got := fn.insertMarkers(text); got != l.want {
+				t.Fatalf("got %q, want %q", got, l.want)
+			}
+		})
+	}
+}
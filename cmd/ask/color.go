@@ -0,0 +1,190 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Colors of the output, set with -color and the theme section of the configuration file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// The ANSI escape sequences written to the terminal. They are empty when the colors are disabled.
+var (
+	reset     string
+	bold      string
+	underline string
+
+	// styleDim is used for the headers, the tool calls, the statistics and the secondary text.
+	styleDim       string
+	styleReasoning string
+	// styleAnswer is used for the answer rendered on the terminal.
+	styleAnswer   string
+	styleCitation string
+	// styleCode is used for the inline code.
+	styleCode    string
+	styleKeyword string
+	styleString  string
+	styleNumber  string
+	styleComment string
+)
+
+// colors is set when the colors are enabled.
+var colors bool
+
+// theme is the theme section of the configuration file. Each value is a space separated list of styles among
+// bold, faint, italic, underline, the color names (black, red, green, yellow, blue, magenta, cyan, white),
+// optionally prefixed with "hi" for the bright variant, or raw SGR parameters like "38;5;208". "none" means
+// the default style of the terminal. The values not specified are the ones of defaultTheme.
+//
+// Example:
+//
+//	# ~/.config/ask/config.yaml
+//	theme:
+//	  reasoning: faint italic
+//	  citation: blue
+//	  keyword: bold magenta
+type theme struct {
+	Dim       string `yaml:"dim"`
+	Reasoning string `yaml:"reasoning"`
+	Answer    string `yaml:"answer"`
+	Citation  string `yaml:"citation"`
+	Code      string `yaml:"code"`
+	Keyword   string `yaml:"keyword"`
+	String    string `yaml:"string"`
+	Number    string `yaml:"number"`
+	Comment   string `yaml:"comment"`
+}
+
+// defaultTheme is the theme used for the values not set in the configuration file.
+var defaultTheme = theme{
+	Dim:     "hiblack",
+	Code:    "cyan",
+	Keyword: "magenta",
+	String:  "green",
+	Number:  "yellow",
+	Comment: "hiblack",
+}
+
+// curTheme is the theme loaded from the configuration file by initColors.
+var curTheme = defaultTheme
+
+var sgrCodes = map[string]string{
+	"bold": "1", "faint": "2", "italic": "3", "underline": "4",
+	"black": "30", "red": "31", "green": "32", "yellow": "33", "blue": "34", "magenta": "35", "cyan": "36", "white": "37",
+	"hiblack": "90", "hired": "91", "higreen": "92", "hiyellow": "93", "hiblue": "94", "himagenta": "95", "hicyan": "96", "hiwhite": "97",
+}
+
+var reSGR = regexp.MustCompile(`^[0-9]+(;[0-9]+)*$`)
+
+// sgr returns the escape sequence of the space separated styles.
+func sgr(spec string) (string, error) {
+	var codes []string
+	for _, f := range strings.Fields(spec) {
+		if f == "none" {
+			continue
+		}
+		c, ok := sgrCodes[f]
+		if !ok {
+			if !reSGR.MatchString(f) {
+				return "", fmt.Errorf("unknown style %q", f)
+			}
+			c = f
+		}
+		codes = append(codes, c)
+	}
+	if len(codes) == 0 {
+		return "", nil
+	}
+	return "\x1b[" + strings.Join(codes, ";") + "m", nil
+}
+
+// colorFlag is -color. Setting it enables or disables the colors.
+type colorFlag string
+
+func (c *colorFlag) Set(v string) error {
+	if err := setColors(v); err != nil {
+		return err
+	}
+	*c = colorFlag(v)
+	return nil
+}
+
+func (c *colorFlag) String() string {
+	return string(*c)
+}
+
+// initColors loads the theme from the configuration file and enables the colors when the output is a
+// terminal and NO_COLOR is not set.
+func initColors() error {
+	cfg, p, err := readConfig()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if cfg != nil {
+		t := &cfg.Theme
+		for _, v := range []string{t.Dim, t.Reasoning, t.Answer, t.Citation, t.Code, t.Keyword, t.String, t.Number, t.Comment} {
+			if _, err := sgr(v); err != nil {
+				return fmt.Errorf("%s: theme: %w", p, err)
+			}
+		}
+		curTheme = *t
+	}
+	return setColors("auto")
+}
+
+// setColors sets the escape sequences: always enables the colors, never disables them and auto enables them
+// when stdout or stderr is a terminal and NO_COLOR is not set.
+func setColors(mode string) error {
+	switch mode {
+	case "always":
+		colors = true
+	case "never":
+		colors = false
+	case "auto":
+		// https://no-color.org/
+		colors = os.Getenv("NO_COLOR") == "" && (term.IsTerminal(int(os.Stdout.Fd())) || term.IsTerminal(int(os.Stderr.Fd())))
+	default:
+		return errors.New("must be always, never or auto")
+	}
+	for _, s := range []struct {
+		v    *string
+		spec string
+	}{
+		{&reset, "0"},
+		{&bold, "bold"},
+		{&underline, "underline"},
+		{&styleDim, curTheme.Dim},
+		{&styleReasoning, curTheme.Reasoning},
+		{&styleAnswer, curTheme.Answer},
+		{&styleCitation, curTheme.Citation},
+		{&styleCode, curTheme.Code},
+		{&styleKeyword, curTheme.Keyword},
+		{&styleString, curTheme.String},
+		{&styleNumber, curTheme.Number},
+		{&styleComment, curTheme.Comment},
+	} {
+		*s.v = ""
+		if colors {
+			// The theme was validated by initColors.
+			*s.v, _ = sgr(s.spec)
+		}
+	}
+	return nil
+}
+
+// paint returns s in the style, reset afterward.
+func paint(style, s string) string {
+	if style == "" || s == "" {
+		return s
+	}
+	return style + s + reset
+}
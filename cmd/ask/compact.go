@@ -0,0 +1,52 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Compaction of the long chat conversations with -compact, summarizing the oldest turns.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/maruel/genai"
+)
+
+const compactPrompt = "Summarize the conversation so far for your own future reference: the facts, the decisions, the " +
+	"open questions and the content of the files and the code discussed that is still relevant. Reply only with " +
+	"the summary."
+
+// compactSummaryPrefix introduces the summary in the first message kept.
+const compactSummaryPrefix = "Summary of the earlier conversation:\n\n"
+
+// compactHistory summarizes the turns of the conversation before the last keep ones with the model. The summary
+// is prepended to the first message kept, since the roles must alternate.
+//
+// The conversation is returned as is when it has no more than keep turns.
+func compactHistory(ctx context.Context, c genai.Provider, msgs genai.Messages, keep int) (genai.Messages, error) {
+	var starts []int
+	for i := range msgs {
+		if len(msgs[i].Requests) != 0 {
+			starts = append(starts, i)
+		}
+	}
+	if keep < 1 || len(starts) <= keep {
+		return msgs, nil
+	}
+	cut := starts[len(starts)-keep]
+	res, err := c.GenSync(ctx, append(slices.Clip(msgs[:cut]), genai.NewTextMessage(compactPrompt)))
+	if err != nil {
+		return nil, err
+	}
+	summary := strings.TrimSpace(res.String())
+	if summary == "" {
+		return nil, errors.New("the summary is empty")
+	}
+	// Copy the first message kept since the branches share their messages.
+	first := msgs[cut]
+	first.Requests = append([]genai.Request{{Text: compactSummaryPrefix + summary}}, first.Requests...)
+	return append(genai.Messages{first}, msgs[cut+1:]...), nil
+}
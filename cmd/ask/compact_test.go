@@ -0,0 +1,56 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Tests of the compaction of the chat conversations.
+
+package main
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/maruel/genai"
+)
+
+// summarizer is a provider replying with the number of messages it received.
+type summarizer struct {
+	genai.Provider
+}
+
+func (s *summarizer) GenSync(ctx context.Context, msgs genai.Messages, opts ...genai.GenOption) (genai.Result, error) {
+	if err := msgs.Validate(); err != nil {
+		return genai.Result{}, err
+	}
+	return genai.Result{Message: genai.Message{Replies: []genai.Reply{{Text: strconv.Itoa(len(msgs)) + " messages"}}}}, nil
+}
+
+func TestCompactHistory(t *testing.T) {
+	var msgs genai.Messages
+	for i := range 4 {
+		msgs = append(msgs, genai.NewTextMessage("prompt "+strconv.Itoa(i)), genai.Message{Replies: []genai.Reply{{Text: "reply"}}})
+	}
+	got, err := compactHistory(t.Context(), &summarizer{}, msgs, 4)
+	if err != nil || len(got) != len(msgs) {
+		t.Fatalf("%d turns are kept: %d messages, %v", 4, len(got), err)
+	}
+	got, err = compactHistory(t.Context(), &summarizer{}, msgs, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := got.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || countTurns(got) != 1 {
+		t.Fatalf("unexpected conversation %v", got)
+	}
+	// The 3 oldest turns and the request to summarize them.
+	if r := got[0].Requests; len(r) != 2 || r[0].Text != compactSummaryPrefix+"7 messages" || r[1].Text != "prompt 3" {
+		t.Fatalf("unexpected first message %v", r)
+	}
+	// The original conversation is not modified.
+	if len(msgs[6].Requests) != 1 {
+		t.Fatal("the original conversation was modified")
+	}
+}
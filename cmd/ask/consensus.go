@@ -0,0 +1,157 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Best-of-n sampling with -n, selecting the answer by consensus or with a judge model.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/maruel/ask/pkg/ask"
+	"github.com/maruel/genai"
+	"github.com/mattn/go-colorable"
+	"golang.org/x/sync/errgroup"
+)
+
+const judgePrompt = `Here is a request and %d candidate answers. Pick the best answer: the most correct, complete and
+helpful. Reply with only the number of the best candidate.
+
+Request:
+%s
+`
+
+var reFirstNumber = regexp.MustCompile(`\d+`)
+
+// bestOf sends the request n times concurrently and prints the answer selected by mode: consensus picks the
+// most frequent answer and judge asks the judge model to pick the best one. showAll prints all the candidates
+// first.
+func bestOf(ctx context.Context, c genai.Provider, loadJudge func(ctx context.Context) (genai.Provider, error), o ask.Options, n int, mode string, showAll, stdinUsed bool) error {
+	var stdin []byte
+	if !stdinUsed && stdinIsPiped() {
+		var err error
+		if stdin, err = io.ReadAll(os.Stdin); err != nil {
+			return err
+		}
+	}
+	o.Provider = c
+	candidates := make([]string, n)
+	errs := make([]error, n)
+	var eg errgroup.Group
+	for i := range n {
+		eg.Go(func() error {
+			opts := o
+			if stdin != nil {
+				opts.Stdin = bytes.NewReader(stdin)
+			}
+			res, err := ask.Run(ctx, opts)
+			candidates[i], errs[i] = res.String(), err
+			_, _ = fmt.Fprintf(os.Stderr, ".")
+			return nil
+		})
+	}
+	_ = eg.Wait()
+	_, _ = fmt.Fprintf(os.Stderr, "\n")
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// Keep the candidates that succeeded.
+	var ok []string
+	for i := range candidates {
+		if errs[i] != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "warning: candidate %d: %v\n", i+1, errs[i])
+			continue
+		}
+		ok = append(ok, candidates[i])
+	}
+	if len(ok) == 0 {
+		return errors.Join(errs...)
+	}
+
+	w := colorable.NewColorableStdout()
+	if showAll {
+		for i, s := range ok {
+			_, _ = fmt.Fprintf(w, "%sCandidate %d:%s\n%s\n\n", styleDim, i+1, reset, strings.TrimSpace(s))
+		}
+	}
+	winner := -1
+	if mode == "judge" {
+		j, err := loadJudge(ctx)
+		if err != nil {
+			return err
+		}
+		if winner, err = judge(ctx, j, o.Prompt, ok); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "warning: the judge failed, using the consensus: %v\n", err)
+		} else {
+			_, _ = fmt.Fprintf(os.Stderr, "note: %s picked candidate %d of %d\n", j.ModelID(), winner+1, len(ok))
+		}
+	}
+	if winner < 0 {
+		var votes int
+		winner, votes = consensus(ok)
+		_, _ = fmt.Fprintf(os.Stderr, "note: %d of %d candidates agree\n", votes, len(ok))
+	}
+	if showAll {
+		_, _ = fmt.Fprintf(w, "%sSelected: candidate %d%s\n", styleDim, winner+1, reset)
+	}
+	s := ok[winner]
+	if !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+// consensus returns the index of the most frequent answer, the first one on a tie, and its number of votes.
+//
+// The answers are compared ignoring the case, the whitespace and the trailing punctuation.
+func consensus(answers []string) (int, int) {
+	counts := map[string]int{}
+	first := map[string]int{}
+	best, votes := 0, 0
+	for i, a := range answers {
+		k := normalizeAnswer(a)
+		if _, ok := first[k]; !ok {
+			first[k] = i
+		}
+		counts[k]++
+		if counts[k] > votes || (counts[k] == votes && first[k] < best) {
+			best, votes = first[k], counts[k]
+		}
+	}
+	return best, votes
+}
+
+func normalizeAnswer(s string) string {
+	s = strings.Join(strings.Fields(strings.ToLower(s)), " ")
+	return strings.TrimRightFunc(s, unicode.IsPunct)
+}
+
+// judge asks the model to pick the best answer and returns its index.
+func judge(ctx context.Context, c genai.Provider, prompt string, answers []string) (int, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, judgePrompt, len(answers), prompt)
+	for i, a := range answers {
+		fmt.Fprintf(&b, "\nCandidate %d:\n%s\n", i+1, strings.TrimSpace(a))
+	}
+	res, err := c.GenSync(ctx, genai.Messages{genai.NewTextMessage(b.String())})
+	if err != nil {
+		return 0, err
+	}
+	m := reFirstNumber.FindString(res.String())
+	i, err := strconv.Atoi(m)
+	if err != nil || i < 1 || i > len(answers) {
+		return 0, fmt.Errorf("unexpected reply %q", res.String())
+	}
+	return i - 1, nil
+}
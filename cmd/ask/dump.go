@@ -0,0 +1,103 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Dumping the HTTP requests sent to the provider with -dump-request-json.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/maruel/ask/pkg/ask"
+)
+
+// dumpedRequest is the JSON representation of a request sent to the provider.
+type dumpedRequest struct {
+	Method string          `json:"method"`
+	URL    string          `json:"url"`
+	Header http.Header     `json:"header,omitzero"`
+	Body   json.RawMessage `json:"body,omitzero"`
+}
+
+// dumpRequests is an http.RoundTripper writing each request as indented JSON to w before sending it.
+//
+// The credentials in the headers and the query arguments are redacted. The body is written as is; a body
+// that is not JSON is written as a string.
+type dumpRequests struct {
+	Transport http.RoundTripper
+	w         io.Writer
+	mu        sync.Mutex
+}
+
+func (d *dumpRequests) RoundTrip(req *http.Request) (*http.Response, error) {
+	e := dumpedRequest{Method: req.Method, URL: redactURL(req.URL), Header: redactHeader(req.Header)}
+	if req.Body != nil && req.Body != http.NoBody {
+		b, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(b))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(b)), nil
+		}
+		if json.Valid(b) {
+			e.Body = b
+		} else if e.Body, err = json.Marshal(string(b)); err != nil {
+			return nil, err
+		}
+	}
+	out, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	_, err = d.w.Write(append(out, '\n'))
+	d.mu.Unlock()
+	if err != nil {
+		// Do not fail the request for a debugging aid.
+		slog.Warn("dump-request-json", "error", err)
+	}
+	return d.Transport.RoundTrip(req)
+}
+
+func (d *dumpRequests) Unwrap() http.RoundTripper {
+	return d.Transport
+}
+
+// redactHeader returns a copy of h with the values of the headers that look like credentials redacted.
+func redactHeader(h http.Header) http.Header {
+	out := h.Clone()
+	for k := range out {
+		if isSecretHeader(k) {
+			out[k] = []string{ask.RedactPlaceholder}
+		}
+	}
+	return out
+}
+
+// redactURL returns u with the values of the query arguments that look like credentials redacted.
+func redactURL(u *url.URL) string {
+	q := u.Query()
+	changed := false
+	for k := range q {
+		if isSecretHeader(k) {
+			q[k] = []string{ask.RedactPlaceholder}
+			changed = true
+		}
+	}
+	if !changed {
+		return u.String()
+	}
+	c := *u
+	c.RawQuery = q.Encode()
+	return c.String()
+}
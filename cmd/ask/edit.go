@@ -0,0 +1,89 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Writing the prompt in the user's editor with -edit.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const editTemplate = `
+# Write the prompt above. Lines starting with '#' are ignored and an empty prompt aborts.
+`
+
+// editPrompt opens $VISUAL or $EDITOR on a template starting with initial and returns the prompt saved.
+//
+// When no editor is configured, the prompt is read from stdin instead. The second return value is true in
+// this case, so stdin is not sent as a document too.
+func editPrompt(ctx context.Context, initial string) (string, bool, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		if !stdinIsPiped() {
+			_, _ = fmt.Fprintf(os.Stderr, "No $EDITOR set; type the prompt then Ctrl-D:\n")
+		}
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", true, err
+		}
+		p := strings.TrimSpace(string(b))
+		if p == "" {
+			return "", true, errors.New("aborting due to empty prompt")
+		}
+		return p, true, nil
+	}
+	f, err := os.CreateTemp("", "ask-prompt-*.md")
+	if err != nil {
+		return "", false, err
+	}
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+	_, err = f.WriteString(initial + "\n" + editTemplate)
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return "", false, err
+	}
+	// The editor may have arguments, e.g. "code --wait".
+	args := strings.Fields(editor)
+	cmd := exec.CommandContext(ctx, args[0], append(args[1:], f.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", false, fmt.Errorf("editor %q failed: %w", editor, err)
+	}
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", false, err
+	}
+	p := stripComments(string(b))
+	if p == "" {
+		return "", false, errors.New("aborting due to empty prompt")
+	}
+	return p, false, nil
+}
+
+// stripComments removes the lines starting with '#' and the surrounding whitespace.
+func stripComments(s string) string {
+	var lines []string
+	for l := range strings.Lines(s) {
+		if !strings.HasPrefix(l, "#") {
+			lines = append(lines, l)
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, ""))
+}
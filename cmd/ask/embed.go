@@ -0,0 +1,383 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Subcommand embed computing embedding vectors with the provider's HTTP API.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/maruel/ask/pkg/ask"
+	"github.com/maruel/genai"
+)
+
+// embedAPI describes how to reach a provider's embedding endpoint.
+type embedAPI struct {
+	// url returns the endpoint URL. remote is the value of -remote, if any.
+	url func(remote, model string) string
+	// model is the default embedding model.
+	model string
+	// gemini is true when the endpoint uses Gemini's batchEmbedContents format instead of OpenAI's.
+	gemini bool
+	// ollama is true when the endpoint uses ollama's /api/embed format.
+	ollama bool
+}
+
+// embedAPIs lists the providers with an embedding endpoint.
+//
+// genai doesn't expose embeddings, so the requests are sent directly through the provider's HTTP client, which
+// already handles authentication.
+var embedAPIs = map[string]embedAPI{
+	"gemini": {
+		url: func(_, model string) string {
+			return "https://generativelanguage.googleapis.com/v1beta/models/" + model + ":batchEmbedContents"
+		},
+		model:  "gemini-embedding-001",
+		gemini: true,
+	},
+	"llamacpp": {
+		// llama-server serves the single model it was started with.
+		url: func(remote, _ string) string { return cmp.Or(remote, "http://localhost:8080") + "/v1/embeddings" },
+	},
+	"mistral": {
+		url:   func(_, _ string) string { return "https://api.mistral.ai/v1/embeddings" },
+		model: "mistral-embed",
+	},
+	"ollama": {
+		url:    func(remote, _ string) string { return cmp.Or(remote, "http://localhost:11434") + "/api/embed" },
+		model:  "nomic-embed-text",
+		ollama: true,
+	},
+	"openaichat": {
+		url:   func(_, _ string) string { return "https://api.openai.com/v1/embeddings" },
+		model: "text-embedding-3-small",
+	},
+	"openairesponses": {
+		url:   func(_, _ string) string { return "https://api.openai.com/v1/embeddings" },
+		model: "text-embedding-3-small",
+	},
+	"togetherai": {
+		url:   func(_, _ string) string { return "https://api.together.xyz/v1/embeddings" },
+		model: "BAAI/bge-base-en-v1.5",
+	},
+}
+
+// embedBatchSize is the maximum number of inputs sent in a single request.
+const embedBatchSize = 64
+
+// embedder computes embeddings.
+type embedder struct {
+	c     *http.Client
+	api   embedAPI
+	url   string
+	model string
+	limit *rateLimiter
+}
+
+// newEmbedder returns an embedder for the provider. model may be empty to use the provider's default.
+func newEmbedder(c genai.Provider, remote, model string, limit *rateLimiter) (*embedder, error) {
+	api, ok := embedAPIs[c.Name()]
+	if !ok {
+		return nil, fmt.Errorf("provider %q doesn't support embeddings; supported providers are %s", c.Name(), strings.Join(slices.Sorted(maps.Keys(embedAPIs)), ", "))
+	}
+	if model == "" {
+		model = api.model
+	}
+	return &embedder{c: c.HTTPClient(), api: api, url: api.url(remote, model), model: model, limit: limit}, nil
+}
+
+// embed returns one vector per input.
+func (e *embedder) embed(ctx context.Context, inputs []string) ([][]float64, error) {
+	out := make([][]float64, 0, len(inputs))
+	for batch := range slices.Chunk(inputs, embedBatchSize) {
+		if e.limit != nil {
+			if err := e.limit.wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+		v, err := e.embedBatch(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		if len(v) != len(batch) {
+			return nil, fmt.Errorf("expected %d embeddings, got %d", len(batch), len(v))
+		}
+		out = append(out, v...)
+	}
+	return out, nil
+}
+
+func (e *embedder) embedBatch(ctx context.Context, inputs []string) ([][]float64, error) {
+	var in any
+	switch {
+	case e.api.gemini:
+		type part struct {
+			Text string `json:"text"`
+		}
+		type content struct {
+			Parts []part `json:"parts"`
+		}
+		type request struct {
+			Model   string  `json:"model"`
+			Content content `json:"content"`
+		}
+		reqs := make([]request, len(inputs))
+		for i, s := range inputs {
+			reqs[i] = request{Model: "models/" + e.model, Content: content{Parts: []part{{Text: s}}}}
+		}
+		in = map[string]any{"requests": reqs}
+	default:
+		m := map[string]any{"input": inputs}
+		if e.model != "" {
+			m["model"] = e.model
+		}
+		in = m
+	}
+	b, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embeddings: http %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	switch {
+	case e.api.gemini:
+		var out struct {
+			Embeddings []struct {
+				Values []float64 `json:"values"`
+			} `json:"embeddings"`
+		}
+		if err := json.Unmarshal(body, &out); err != nil {
+			return nil, fmt.Errorf("embeddings: %w", err)
+		}
+		v := make([][]float64, len(out.Embeddings))
+		for i := range out.Embeddings {
+			v[i] = out.Embeddings[i].Values
+		}
+		return v, nil
+	case e.api.ollama:
+		var out struct {
+			Embeddings [][]float64 `json:"embeddings"`
+		}
+		if err := json.Unmarshal(body, &out); err != nil {
+			return nil, fmt.Errorf("embeddings: %w", err)
+		}
+		return out.Embeddings, nil
+	default:
+		var out struct {
+			Data []struct {
+				Index     int       `json:"index"`
+				Embedding []float64 `json:"embedding"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(body, &out); err != nil {
+			return nil, fmt.Errorf("embeddings: %w", err)
+		}
+		v := make([][]float64, len(out.Data))
+		for _, d := range out.Data {
+			if d.Index < 0 || d.Index >= len(v) {
+				return nil, fmt.Errorf("embeddings: unexpected index %d", d.Index)
+			}
+			v[d.Index] = d.Embedding
+		}
+		return v, nil
+	}
+}
+
+// embedInput is a text to embed and its identifier.
+type embedInput struct {
+	id   string
+	text string
+}
+
+// readEmbedInputs reads the prompt arguments, the files and stdin as texts to embed.
+//
+// The files are expanded like -f of ask: the directories and the glob patterns are replaced with the files
+// they contain, except the ones matching ignore, and git: reads the output of git.
+func readEmbedInputs(ctx context.Context, args, files, ignore []string) ([]embedInput, error) {
+	var inputs []embedInput
+	if query := strings.Join(args, " "); query != "" {
+		inputs = append(inputs, embedInput{id: "prompt", text: query})
+	}
+	files, warnings, err := ask.ExpandFiles(files, ignore, ask.DefaultMaxFileSize)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range warnings {
+		_, _ = fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+	for _, n := range files {
+		if isURL(n) {
+			return nil, fmt.Errorf("%s: URLs are not supported for embeddings", n)
+		}
+		b, err := ask.ReadSource(ctx, n)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, embedInput{id: n, text: string(b)})
+	}
+	if stdinIsPiped() {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) != 0 {
+			inputs = append(inputs, embedInput{id: "stdin", text: string(b)})
+		}
+	}
+	return inputs, nil
+}
+
+func cmdEmbed(ctx context.Context, args []string) error {
+	var pf providerFlags
+	pf.register(ctx)
+	var files stringsFlag
+	flag.Var(&files, "f", "text file(s) to embed; can be specified multiple times; git:diff, git:staged or git:<revision> embed a git diff, git:tree the files tracked by git; a directory or a glob pattern like 'docs/**/*.md' embeds the files found")
+	var ignore stringsFlag
+	flag.Var(&ignore, "ignore", "glob pattern of the files and directories to skip when -f is a directory or a glob pattern; can be specified multiple times")
+	format := flag.String("format", "json", "output format: json (one object per line), csv or bin (little endian float32, see writeEmbeddings)")
+	_ = flag.CommandLine.Parse(args)
+	if err := applyProfile(pf.profile); err != nil {
+		return err
+	}
+	if pf.provider == "" {
+		return errors.New("-provider is required")
+	}
+	if *format != "json" && *format != "csv" && *format != "bin" {
+		return fmt.Errorf("invalid -format %q", *format)
+	}
+	inputs, err := readEmbedInputs(ctx, flag.Args(), files, ignore)
+	if err != nil {
+		return err
+	}
+	if len(inputs) == 0 {
+		return errors.New("provide a text as an argument, input files or stdin")
+	}
+	e, err := pf.loadEmbedder(ctx, pf.embedModel())
+	if err != nil {
+		return err
+	}
+	defer pf.close()
+	texts := make([]string, len(inputs))
+	for i := range inputs {
+		texts[i] = inputs[i].text
+	}
+	vectors, err := e.embed(ctx, texts)
+	if err != nil {
+		return err
+	}
+	if pf.errRR != nil {
+		return pf.errRR
+	}
+	return writeEmbeddings(os.Stdout, *format, inputs, vectors)
+}
+
+// writeEmbeddings writes one vector per line, or one record per vector with the bin format.
+//
+// A bin record is, in little endian: the uint32 length of the identifier, the identifier in UTF-8, the uint32
+// number of dimensions then each dimension as a float32.
+func writeEmbeddings(w io.Writer, format string, inputs []embedInput, vectors [][]float64) error {
+	if format == "bin" {
+		bw := bufio.NewWriter(w)
+		for i, v := range vectors {
+			b := binary.LittleEndian.AppendUint32(nil, uint32(len(inputs[i].id)))
+			b = append(b, inputs[i].id...)
+			b = binary.LittleEndian.AppendUint32(b, uint32(len(v)))
+			for _, x := range v {
+				b = binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(x)))
+			}
+			if _, err := bw.Write(b); err != nil {
+				return err
+			}
+		}
+		return bw.Flush()
+	}
+	if format == "csv" {
+		cw := csv.NewWriter(w)
+		for i, v := range vectors {
+			rec := make([]string, 0, len(v)+1)
+			rec = append(rec, inputs[i].id)
+			for _, x := range v {
+				rec = append(rec, strconv.FormatFloat(x, 'g', -1, 64))
+			}
+			if err := cw.Write(rec); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	enc := json.NewEncoder(w)
+	for i, v := range vectors {
+		if err := enc.Encode(struct {
+			ID        string    `json:"id"`
+			Embedding []float64 `json:"embedding"`
+		}{inputs[i].id, v}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// embedModel returns the -model specified on the command line. The value from ASK_MODEL is ignored since it
+// is a generation model.
+func (p *providerFlags) embedModel() string {
+	model := ""
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "model" || f.Name == "m" {
+			model = p.model
+		}
+	})
+	return model
+}
+
+// loadEmbedder connects to the provider selected by the flags for embeddings with the model, the provider's
+// default embedding model when empty.
+//
+// close must be called once the embedder is not used anymore.
+func (p *providerFlags) loadEmbedder(ctx context.Context, model string) (*embedder, error) {
+	if err := p.setup(); err != nil {
+		return nil, err
+	}
+	// The generation model is not used.
+	c, err := p.loadProviderModel(ctx, p.provider, "")
+	if err != nil {
+		return nil, err
+	}
+	// The embedder applies the rate limit since its requests do not go through the provider's generation
+	// methods.
+	return newEmbedder(c, p.remote, model, p.limiter)
+}
@@ -0,0 +1,52 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Tests of the inputs of the embed subcommand.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestReadEmbedInputs(t *testing.T) {
+	// Stdin is read when it is not a terminal.
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = null
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		_ = null.Close()
+	})
+	d := t.TempDir()
+	for _, n := range []string{"a.md", "b.md", "sub/c.md", "sub/d.txt"} {
+		p := filepath.Join(d, n)
+		if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(n), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	inputs, err := readEmbedInputs(t.Context(), []string{"hello"}, []string{filepath.Join(d, "**", "*.md")}, []string{"b.md"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, in := range inputs {
+		got = append(got, in.text)
+	}
+	if want := []string{"hello", "a.md", "sub/c.md"}; !slices.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if _, err := readEmbedInputs(t.Context(), nil, []string{"https://example.com"}, nil); err == nil {
+		t.Fatal("expected an error for an URL")
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Loading of the environment variables from a .env file with -env-file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// loadEnvFromArgs loads the -env-file specified in args, if any.
+//
+// The arguments are scanned before the flags are registered since the default values of the flags, e.g.
+// -provider, are read from the environment at registration. Like the flag package, the scan stops at the
+// first argument that is not a flag or at "--", after the name of the subcommand, if any. Since the flags are
+// not registered yet, a flag without "=" is assumed to take the next argument as its value, unless it is a
+// boolean flag registered already.
+func loadEnvFromArgs(args []string) error {
+	if len(args) != 0 {
+		if n, ok := subcommands[args[0]]; ok {
+			args = args[min(n, len(args)):]
+		}
+	}
+	path := ""
+	override := false
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" || len(a) < 2 || a[0] != '-' {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		switch name {
+		case "env-file":
+			if !hasValue {
+				if i+1 == len(args) {
+					return errors.New("flag needs an argument: -env-file")
+				}
+				i++
+				value = args[i]
+			}
+			path = value
+		case "env-override":
+			override = true
+			if hasValue {
+				var err error
+				if override, err = strconv.ParseBool(value); err != nil {
+					return fmt.Errorf("invalid value %q for flag -env-override", value)
+				}
+			}
+		default:
+			if f := flag.Lookup(name); f != nil {
+				if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+					continue
+				}
+			}
+			if !hasValue && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+			}
+		}
+	}
+	if path == "" {
+		return nil
+	}
+	return loadEnvFile(path, override)
+}
+
+// loadEnvFile sets the environment variables declared as KEY=VALUE in the file.
+//
+// Variables already set are kept unless override is true.
+func loadEnvFile(path string, override bool) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for line := 1; s.Scan(); line++ {
+		k, v, err := parseEnvLine(s.Text())
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if k == "" {
+			continue
+		}
+		if _, ok := os.LookupEnv(k); ok && !override {
+			continue
+		}
+		if err := os.Setenv(k, v); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+	return s.Err()
+}
+
+// parseEnvLine parses a line of a .env file. It returns an empty key for blank lines and comments.
+//
+// Values can be double quoted with backslash escapes, single quoted to be taken literally, or unquoted where a
+// " #" starts a comment.
+func parseEnvLine(l string) (string, string, error) {
+	l = strings.TrimSpace(l)
+	if l == "" || strings.HasPrefix(l, "#") {
+		return "", "", nil
+	}
+	l = strings.TrimPrefix(l, "export ")
+	k, v, ok := strings.Cut(l, "=")
+	k = strings.TrimSpace(k)
+	if !ok || k == "" || strings.ContainsAny(k, " \t") {
+		return "", "", fmt.Errorf("expected KEY=VALUE, got %q", l)
+	}
+	v = strings.TrimSpace(v)
+	switch {
+	case strings.HasPrefix(v, `"`):
+		end := -1
+		for i := 1; i < len(v); i++ {
+			if v[i] == '\\' {
+				i++
+			} else if v[i] == '"' {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated quote for %s", k)
+		}
+		u, err := strconv.Unquote(v[:end+1])
+		if err != nil {
+			return "", "", fmt.Errorf("invalid value for %s: %w", k, err)
+		}
+		v = u
+	case strings.HasPrefix(v, "'"):
+		end := strings.IndexByte(v[1:], '\'')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated quote for %s", k)
+		}
+		v = v[1 : 1+end]
+	default:
+		if i := strings.Index(v, " #"); i >= 0 {
+			v = strings.TrimSpace(v[:i])
+		}
+	}
+	return k, v, nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Tests of the scan of the arguments for -env-file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadEnvFromArgs(t *testing.T) {
+	p := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(p, []byte("ASK_TEST_ENV=loaded\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	data := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"-env-file", p, "prompt"}, true},
+		{[]string{"-env-file=" + p}, true},
+		{[]string{"-p", "openai", "--env-file", p, "prompt"}, true},
+		{[]string{"chat", "-env-file", p}, true},
+		{[]string{"rag", "index", "-env-file", p, "dir"}, true},
+		{[]string{"-json-errors", "-env-file", p}, true},
+		// Like the flag package, the scan stops at the first argument that is not a flag.
+		{[]string{"what", "is", "-env-file", p}, false},
+		{[]string{"-p", "openai", "prompt", "-env-file", p}, false},
+		{[]string{"-env-override", "prompt", "-env-file", p}, false},
+		{[]string{"--", "-env-file", p}, false},
+		{[]string{"rag", "index", "dir", "-env-file", p}, false},
+	}
+	for i, line := range data {
+		t.Setenv("ASK_TEST_ENV", "")
+		_ = os.Unsetenv("ASK_TEST_ENV")
+		if err := loadEnvFromArgs(line.args); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if got := os.Getenv("ASK_TEST_ENV") == "loaded"; got != line.want {
+			t.Errorf("#%d: %q: loaded %t, want %t", i, line.args, got, line.want)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Export of the conversation with -export and ask export, for archiving and sharing.
+
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/maruel/genai"
+)
+
+// exportedConversation is the conversation written by -export as JSON.
+type exportedConversation struct {
+	Provider     string         `json:"provider"`
+	Model        string         `json:"model"`
+	SystemPrompt string         `json:"system_prompt,omitzero"`
+	Messages     genai.Messages `json:"messages"`
+	Usage        genai.Usage    `json:"usage"`
+	// Cost is the estimated cost in US dollars, 0 when the price of the model is unknown.
+	Cost float64 `json:"cost_usd,omitzero"`
+}
+
+// writeExport writes the conversation to path, as JSON when the extension is .json and as markdown otherwise.
+func writeExport(path string, e *exportedConversation) error {
+	var b []byte
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var err error
+		if b, err = json.MarshalIndent(e, "", "  "); err != nil {
+			return err
+		}
+		b = append(b, '\n')
+	} else {
+		b = []byte(exportMarkdown(e))
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// exportMarkdown returns the conversation as a markdown document. The documents are listed by name, not
+// embedded.
+func exportMarkdown(e *exportedConversation) string {
+	var b strings.Builder
+	if e.Provider != "" {
+		fmt.Fprintf(&b, "# %s/%s\n\n", e.Provider, e.Model)
+	} else {
+		// A session doesn't record the provider.
+		b.WriteString("# Conversation\n\n")
+	}
+	if e.SystemPrompt != "" {
+		fmt.Fprintf(&b, "## System prompt\n\n%s\n\n", strings.TrimSpace(e.SystemPrompt))
+	}
+	var citations []string
+	for i := range e.Messages {
+		m := &e.Messages[i]
+		if len(m.Requests) != 0 {
+			b.WriteString("## User\n\n")
+			for j := range m.Requests {
+				r := &m.Requests[j]
+				if r.Text != "" {
+					fmt.Fprintf(&b, "%s\n\n", strings.TrimSpace(r.Text))
+				} else if !r.Doc.IsZero() {
+					fmt.Fprintf(&b, "- Attached: %s\n\n", docRef(&r.Doc))
+				}
+			}
+		}
+		for j := range m.ToolCallResults {
+			t := &m.ToolCallResults[j]
+			fmt.Fprintf(&b, "## Tool result %s\n\n%s\n", t.Name, fence(t.Result))
+		}
+		if len(m.Replies) != 0 {
+			b.WriteString("## Assistant\n\n")
+		}
+		for j := range m.Replies {
+			r := &m.Replies[j]
+			switch {
+			case r.Reasoning != "":
+				fmt.Fprintf(&b, "<details>\n<summary>Reasoning</summary>\n\n%s\n\n</details>\n\n", strings.TrimSpace(r.Reasoning))
+			case r.Text != "":
+				fmt.Fprintf(&b, "%s\n\n", strings.TrimSpace(r.Text))
+			case !r.ToolCall.IsZero() && r.ToolCall.Name != "":
+				fmt.Fprintf(&b, "Tool call %s:\n\n%s\n", r.ToolCall.Name, fence(r.ToolCall.Arguments))
+			case !r.Doc.IsZero():
+				fmt.Fprintf(&b, "- Generated: %s\n\n", docRef(&r.Doc))
+			case !r.Citation.IsZero():
+				for k := range r.Citation.Sources {
+					if src := &r.Citation.Sources[k]; src.URL != "" {
+						citations = append(citations, fmt.Sprintf("- [%s](%s)", cmp.Or(src.Title, src.URL), src.URL))
+					}
+				}
+			}
+		}
+	}
+	if len(citations) != 0 {
+		fmt.Fprintf(&b, "## Citations\n\n%s\n\n", strings.Join(citations, "\n"))
+	}
+	if u := &e.Usage; u.InputTokens+u.OutputTokens+u.TotalTokens != 0 {
+		fmt.Fprintf(&b, "## Usage\n\n%s\n", e.Usage.String())
+	}
+	if e.Cost != 0 {
+		fmt.Fprintf(&b, "\nEstimated cost: $%.4f\n", e.Cost)
+	}
+	return b.String()
+}
+
+// docRef returns a reference to a document: its name and its size when its content is saved, a link when
+// only its URL is, since the link may have expired.
+func docRef(d *genai.Doc) string {
+	name := d.GetFilename()
+	switch {
+	case d.URL != "":
+		return fmt.Sprintf("[%s](%s) (not saved, the link may have expired)", cmp.Or(name, d.URL), d.URL)
+	case d.Src != nil:
+		if n, err := d.Src.Seek(0, io.SeekEnd); err == nil {
+			_, _ = d.Src.Seek(0, io.SeekStart)
+			return fmt.Sprintf("%s (%d bytes)", name, n)
+		}
+	}
+	return name
+}
+
+func cmdExport(args []string) error {
+	out := flag.String("o", "", "file to write the transcript to instead of stdout")
+	asHTML := flag.Bool("html", false, "write the transcript as an HTML fragment instead of markdown")
+	_ = flag.CommandLine.Parse(args)
+	p := flag.Arg(0)
+	if flag.NArg() > 1 {
+		// The flags can also follow the session, e.g. ask export last -o out.md.
+		_ = flag.CommandLine.Parse(flag.Args()[1:])
+		if flag.NArg() != 0 {
+			return errors.New("unexpected arguments")
+		}
+	}
+	if p == "" {
+		return errors.New("specify a session file or name, e.g. ask export last -o out.md")
+	}
+	if _, err := os.Stat(p); err != nil {
+		// Not a file, try a session name.
+		if p, err = sessionPath(p); err != nil {
+			return err
+		}
+	}
+	e, err := loadTranscript(p)
+	if err != nil {
+		return err
+	}
+	s := exportMarkdown(e)
+	if *asHTML {
+		s = markdownToHTML(s)
+	}
+	if *out == "" {
+		_, err = os.Stdout.WriteString(s)
+		return err
+	}
+	return os.WriteFile(*out, []byte(s), 0o644)
+}
+
+// loadTranscript reads a session or a conversation written by -export as JSON. The documents saved with
+// neither their content nor their URL are replaced with a placeholder instead of failing the whole file.
+func loadTranscript(p string) (*exportedConversation, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var raw any
+	if err = d.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	replaceMissingDocs(raw)
+	if b, err = json.Marshal(raw); err != nil {
+		return nil, err
+	}
+	e := &exportedConversation{}
+	if _, ok := raw.([]any); ok {
+		// A session is only the messages.
+		err = json.Unmarshal(b, &e.Messages)
+	} else {
+		err = json.Unmarshal(b, e)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	return e, nil
+}
+
+// replaceMissingDocs replaces in place the documents of the decoded JSON that have a name but neither their
+// content nor their URL with a text placeholder.
+func replaceMissingDocs(v any) {
+	switch v := v.(type) {
+	case []any:
+		for _, i := range v {
+			replaceMissingDocs(i)
+		}
+	case map[string]any:
+		if d, ok := v["doc"].(map[string]any); ok && d["bytes"] == nil && d["url"] == nil {
+			if name, _ := d["filename"].(string); name != "" {
+				delete(v, "doc")
+				v["text"] = "_" + name + ": missing_"
+			}
+		}
+		for _, i := range v {
+			replaceMissingDocs(i)
+		}
+	}
+}
+
+// fence returns s in a code block that s cannot close.
+func fence(s string) string {
+	f := "```"
+	for strings.Contains(s, f) {
+		f += "`"
+	}
+	return f + "\n" + strings.TrimRight(s, "\n") + "\n" + f + "\n\n"
+}
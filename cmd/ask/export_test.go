@@ -0,0 +1,57 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Tests of the rendering of the saved conversations.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadTranscript(t *testing.T) {
+	// A session with a document saved with its content, one only by URL and one whose content is missing.
+	session := `[
+		{"request": [{"text": "Compare them."}, {"doc": {"filename": "a.txt", "bytes": "aGVsbG8="}}, {"doc": {"filename": "b.pdf", "url": "https://example.com/b.pdf"}}, {"doc": {"filename": "c.png"}}]},
+		{"reply": [{"reasoning": "They differ."}, {"text": "They are **different**."}]}
+	]`
+	p := filepath.Join(t.TempDir(), "s.json")
+	if err := os.WriteFile(p, []byte(session), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	e, err := loadTranscript(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := exportMarkdown(e)
+	for _, want := range []string{
+		"# Conversation\n",
+		"## User\n\nCompare them.\n",
+		"- Attached: a.txt (5 bytes)\n",
+		"- Attached: [b.pdf](https://example.com/b.pdf) (not saved, the link may have expired)\n",
+		"_c.png: missing_\n",
+		"<summary>Reasoning</summary>\n\nThey differ.\n",
+		"## Assistant\n",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("missing %q in:\n%s", want, md)
+		}
+	}
+	if strings.Contains(md, "## Usage") {
+		t.Errorf("unexpected usage in:\n%s", md)
+	}
+	h := markdownToHTML(md)
+	for _, want := range []string{
+		"<details>\n<summary>Reasoning</summary>\n<p>They differ.</p>\n</details>\n",
+		"<p>They are <strong>different</strong>.</p>\n",
+		`<a href="https://example.com/b.pdf">b.pdf</a>`,
+	} {
+		if !strings.Contains(h, want) {
+			t.Errorf("missing %q in:\n%s", want, h)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Failover to other providers when a provider is unavailable.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/maruel/ask/pkg/ask"
+	"github.com/maruel/genai"
+	"github.com/maruel/httpjson"
+)
+
+// loadFallback loads the primary provider and the fallback providers, returning a provider trying them in
+// order.
+//
+// A provider that cannot be loaded because of a transient error is skipped, since loading may require an
+// HTTP request to select the model.
+func loadFallback(ctx context.Context, primary string, primaryOpts []genai.ProviderOption, fallbacks []string, fallbackOpts []genai.ProviderOption) (genai.Provider, error) {
+	var chain []genai.Provider
+	var errs []error
+	for i, name := range append([]string{primary}, fallbacks...) {
+		name = strings.TrimSpace(name)
+		opts := fallbackOpts
+		if i == 0 {
+			opts = primaryOpts
+		} else if name == "" {
+			return nil, errors.New("invalid empty provider in -provider-fallback")
+		}
+		c, err := ask.LoadProvider(ctx, name, opts...)
+		if err != nil {
+			if !isTransient(ctx, err) {
+				return nil, err
+			}
+			_, _ = fmt.Fprintf(os.Stderr, "warning: skipping provider %q: %v\n", name, err)
+			errs = append(errs, err)
+			continue
+		}
+		chain = append(chain, c)
+	}
+	if len(chain) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	if len(chain) == 1 {
+		return chain[0], nil
+	}
+	return &providerFallback{Provider: chain[0], chain: chain}, nil
+}
+
+// modelTier returns the automatic model selection equivalent to a model, so the fallback providers use a
+// model in the same tier.
+//
+// The tier of a model ID is guessed from its name, since the providers don't report it. The models that are
+// not recognizably small or large are considered good.
+func modelTier(model string) genai.ProviderOptionModel {
+	switch m := genai.ProviderOptionModel(model); m {
+	case genai.ModelCheap, genai.ModelGood, genai.ModelSOTA:
+		return m
+	}
+	m := strings.ToLower(model)
+	for _, s := range []string{"nano", "-mini", "lite", "haiku", "small", "tiny", "instant", "-8b"} {
+		if strings.Contains(m, s) {
+			return genai.ModelCheap
+		}
+	}
+	for _, s := range []string{"opus", "-pro", "large", "grok-4", "reasoner", "405b"} {
+		if strings.Contains(m, s) {
+			return genai.ModelSOTA
+		}
+	}
+	return genai.ModelGood
+}
+
+// isTransient returns true if the error is likely caused by the provider being unavailable or overloaded, so
+// that the same request may succeed on another provider.
+func isTransient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		// The user canceled.
+		return false
+	}
+	var herr *httpjson.Error
+	if errors.As(err, &herr) {
+		switch herr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests:
+			return true
+		default:
+			return herr.StatusCode >= 500
+		}
+	}
+	var nerr net.Error
+	var operr *net.OpError
+	return errors.As(err, &nerr) || errors.As(err, &operr)
+}
+
+// providerFallback wraps a chain of providers, trying the next one when a request fails with a transient
+// error.
+//
+// The embedded Provider is the first of the chain, which is used for the metadata and for GenAsync, since a
+// job is only valid on the provider that created it.
+type providerFallback struct {
+	genai.Provider
+	chain []genai.Provider
+}
+
+func (c *providerFallback) GenSync(ctx context.Context, msgs genai.Messages, opts ...genai.GenOption) (genai.Result, error) {
+	for i, p := range c.chain {
+		res, err := p.GenSync(ctx, msgs, opts...)
+		if err == nil || i == len(c.chain)-1 || !isTransient(ctx, err) {
+			return res, err
+		}
+		c.warn(i, err)
+	}
+	panic("unreachable")
+}
+
+// GenStream only fails over when the error happens before any reply was streamed, since a partial answer
+// was already printed.
+func (c *providerFallback) GenStream(ctx context.Context, msgs genai.Messages, opts ...genai.GenOption) (iter.Seq[genai.Reply], func() (genai.Result, error)) {
+	var res genai.Result
+	var err error
+	seq := func(yield func(genai.Reply) bool) {
+		for i, p := range c.chain {
+			fragments, finish := p.GenStream(ctx, msgs, opts...)
+			streamed := false
+			for f := range fragments {
+				streamed = true
+				if !yield(f) {
+					res, err = finish()
+					return
+				}
+			}
+			res, err = finish()
+			if err == nil || streamed || i == len(c.chain)-1 || !isTransient(ctx, err) {
+				return
+			}
+			c.warn(i, err)
+		}
+	}
+	return seq, func() (genai.Result, error) { return res, err }
+}
+
+func (c *providerFallback) Unwrap() genai.Provider {
+	return c.Provider
+}
+
+func (c *providerFallback) warn(i int, err error) {
+	_, _ = fmt.Fprintf(os.Stderr, "warning: provider %q failed: %v; falling back to %q\n", c.chain[i].Name(), err, c.chain[i+1].Name())
+}
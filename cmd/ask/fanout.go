@@ -0,0 +1,209 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Fan-out of the same prompt to multiple providers and models with -fanout.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/maruel/ask/pkg/ask"
+	"github.com/maruel/genai"
+	"github.com/mattn/go-colorable"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/term"
+)
+
+// fanoutTarget is a provider and model pair of -fanout, and its result.
+type fanoutTarget struct {
+	provider string
+	model    string
+
+	label   string
+	answer  strings.Builder
+	usage   genai.Usage
+	latency time.Duration
+	err     error
+}
+
+// parseFanout parses "provider:model,provider". The model is optional.
+func parseFanout(s string) ([]*fanoutTarget, error) {
+	var out []*fanoutTarget
+	for p := range strings.SplitSeq(s, ",") {
+		prov, model, _ := strings.Cut(strings.TrimSpace(p), ":")
+		if prov == "" {
+			return nil, fmt.Errorf("-fanout: invalid %q, expected provider:model", p)
+		}
+		out = append(out, &fanoutTarget{provider: prov, model: model, label: strings.TrimSuffix(prov+":"+model, ":")})
+	}
+	if len(out) < 2 {
+		return nil, errors.New("-fanout requires at least two provider:model pairs")
+	}
+	return out, nil
+}
+
+// fanout sends the request to all the targets concurrently and prints the answers in the layout: labeled
+// prints each answer once complete, interleaved prints the lines as they are streamed prefixed with their
+// label and columns prints the answers side by side once all are complete. A usage summary follows.
+//
+// c is the provider of the first target, already loaded.
+func fanout(ctx context.Context, c genai.Provider, load func(ctx context.Context, provider, model string) (genai.Provider, error), targets []*fanoutTarget, o ask.Options, layout string, stdinUsed bool) error {
+	var stdin []byte
+	if !stdinUsed && stdinIsPiped() {
+		var err error
+		if stdin, err = io.ReadAll(os.Stdin); err != nil {
+			return err
+		}
+	}
+	w := colorable.NewColorableStdout()
+	var mu sync.Mutex
+	var eg errgroup.Group
+	for i, t := range targets {
+		eg.Go(func() error {
+			p := c
+			if i != 0 {
+				var err error
+				if p, err = load(ctx, t.provider, t.model); err != nil {
+					t.err = err
+					return nil
+				}
+			}
+			t.model = p.ModelID()
+			t.label = p.Name() + ":" + t.model
+			opts := o
+			opts.Provider = p
+			if stdin != nil {
+				opts.Stdin = bytes.NewReader(stdin)
+			}
+			// line is the partial line held with the interleaved layout.
+			var line []byte
+			opts.OnFragment = func(f genai.Reply) {
+				t.answer.WriteString(f.Text)
+				if layout != "interleaved" {
+					return
+				}
+				line = append(line, f.Text...)
+				for {
+					j := bytes.IndexByte(line, '\n')
+					if j < 0 {
+						break
+					}
+					mu.Lock()
+					_, _ = fmt.Fprintf(w, "%s%s |%s %s\n", styleDim, t.label, reset, line[:j])
+					mu.Unlock()
+					line = line[j+1:]
+				}
+			}
+			start := time.Now()
+			res, err := ask.Run(ctx, opts)
+			t.latency = time.Since(start)
+			t.usage = res.Usage
+			t.err = err
+			mu.Lock()
+			defer mu.Unlock()
+			switch layout {
+			case "interleaved":
+				if len(line) != 0 {
+					_, _ = fmt.Fprintf(w, "%s%s |%s %s\n", styleDim, t.label, reset, line)
+				}
+			case "labeled":
+				printFanoutLabeled(w, t)
+			}
+			return nil
+		})
+	}
+	_ = eg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if layout == "columns" {
+		width := 160
+		if tw, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+			width = tw
+		}
+		printFanoutColumns(w, targets, width)
+	}
+
+	// Usage summary.
+	_, _ = io.WriteString(w, "\n")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "Model\tLatency\tIn\tOut\tCost\tError\n")
+	var errs []error
+	for _, t := range targets {
+		cost := "?"
+		if usd, ok := ask.Cost(t.model, &t.usage); ok {
+			cost = fmt.Sprintf("$%.4f", usd)
+		}
+		e := ""
+		if t.err != nil {
+			e = t.err.Error()
+			errs = append(errs, fmt.Errorf("%s: %w", t.label, t.err))
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\n", t.label, t.latency.Round(time.Millisecond), t.usage.InputTokens, t.usage.OutputTokens, cost, e)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(errs) == len(targets) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// printFanoutLabeled prints the answer of a target under its label.
+func printFanoutLabeled(w io.Writer, t *fanoutTarget) {
+	_, _ = fmt.Fprintf(w, "%s── %s ──%s\n", styleDim, t.label, reset)
+	s := strings.TrimRight(t.answer.String(), "\n")
+	if t.err != nil {
+		s += "\nerror: " + t.err.Error()
+	}
+	_, _ = fmt.Fprintf(w, "%s\n\n", strings.TrimLeft(s, "\n"))
+}
+
+// printFanoutColumns prints the answers side by side, wrapped to fit in width.
+func printFanoutColumns(w io.Writer, targets []*fanoutTarget, width int) {
+	const sep = " │ "
+	colw := max((width-visibleLen(sep)*(len(targets)-1))/len(targets), 10)
+	cols := make([][]string, len(targets))
+	rows := 0
+	for i, t := range targets {
+		s := t.answer.String()
+		if t.err != nil {
+			s += "\nerror: " + t.err.Error()
+		}
+		var b strings.Builder
+		ww := &wordWrapper{w: &b, width: colw}
+		_, _ = io.WriteString(ww, s)
+		_ = ww.Flush()
+		cols[i] = append([]string{bold + t.label + reset}, strings.Split(strings.TrimRight(b.String(), "\n"), "\n")...)
+		rows = max(rows, len(cols[i]))
+	}
+	for r := range rows {
+		for i := range cols {
+			if i != 0 {
+				_, _ = io.WriteString(w, styleDim+sep+reset)
+			}
+			cell := ""
+			if r < len(cols[i]) {
+				cell = cols[i][r]
+			}
+			// The code blocks are not wrapped.
+			if r := []rune(cell); visibleLen(cell) > colw && len(r) > colw {
+				cell = string(r[:colw-1]) + "…"
+			}
+			_, _ = io.WriteString(w, cell+strings.Repeat(" ", max(colw-visibleLen(cell), 0)))
+		}
+		_, _ = io.WriteString(w, "\n")
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Syntax highlighting of the fenced code blocks of the answer.
+
+package main
+
+import (
+	"strings"
+)
+
+// syntax is the lexical description of a language, enough to highlight the keywords, the strings, the
+// numbers and the comments.
+type syntax struct {
+	keywords     map[string]bool
+	lineComments []string
+	// blockComment is the start and the end of a comment spanning lines, if any.
+	blockComment [2]string
+	quotes       string
+}
+
+func words(s string) map[string]bool {
+	m := map[string]bool{}
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+var (
+	cLike = [2]string{"/*", "*/"}
+
+	syntaxGo = &syntax{
+		keywords: words(`break case chan const continue default defer else fallthrough for func go goto if import
+			interface map package range return select struct switch type var nil true false iota`),
+		lineComments: []string{"//"}, blockComment: cLike, quotes: "\"'`",
+	}
+	syntaxPython = &syntax{
+		keywords: words(`and as assert async await break class continue def del elif else except finally for from
+			global if import in is lambda nonlocal not or pass raise return try while with yield None True False self`),
+		lineComments: []string{"#"}, quotes: "\"'",
+	}
+	syntaxJS = &syntax{
+		keywords: words(`async await break case catch class const continue debugger default delete do else export
+			extends finally for function if import in instanceof let new of return static super switch this throw try
+			typeof var void while yield null undefined true false interface type enum implements readonly`),
+		lineComments: []string{"//"}, blockComment: cLike, quotes: "\"'`",
+	}
+	syntaxRust = &syntax{
+		keywords: words(`as async await break const continue crate dyn else enum extern false fn for if impl in let
+			loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while`),
+		lineComments: []string{"//"}, blockComment: cLike, quotes: "\"",
+	}
+	syntaxC = &syntax{
+		keywords: words(`auto bool break case catch char class const constexpr continue default delete do double else
+			enum explicit extern false float for friend goto if inline int long namespace new nullptr private
+			protected public return short signed sizeof static struct switch template this throw true try typedef
+			typename union unsigned using virtual void volatile while NULL`),
+		lineComments: []string{"//"}, blockComment: cLike, quotes: "\"'",
+	}
+	syntaxJava = &syntax{
+		keywords: words(`abstract boolean break byte case catch char class const continue default do double else enum
+			extends final finally float for if implements import instanceof int interface long native new package
+			private protected public return short static super switch synchronized this throw throws try void
+			volatile while null true false var fun val when object`),
+		lineComments: []string{"//"}, blockComment: cLike, quotes: "\"'",
+	}
+	syntaxShell = &syntax{
+		keywords: words(`case do done elif else esac export fi for function if in local return then until while
+			echo exit set unset shift source`),
+		lineComments: []string{"#"}, quotes: "\"'",
+	}
+	syntaxSQL = &syntax{
+		keywords: words(`select from where and or not insert into values update set delete create table index drop
+			alter join left right inner outer on group by order having limit as distinct null is in like primary key
+			SELECT FROM WHERE AND OR NOT INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE INDEX DROP ALTER JOIN LEFT
+			RIGHT INNER OUTER ON GROUP BY ORDER HAVING LIMIT AS DISTINCT NULL IS IN LIKE PRIMARY KEY`),
+		lineComments: []string{"--"}, blockComment: cLike, quotes: "'\"",
+	}
+	syntaxData = &syntax{
+		keywords:     words(`true false null yes no`),
+		lineComments: []string{"#"}, quotes: "\"'",
+	}
+
+	// syntaxes maps the language tags of the code blocks to their syntax.
+	syntaxes = map[string]*syntax{
+		"go":         syntaxGo,
+		"golang":     syntaxGo,
+		"py":         syntaxPython,
+		"python":     syntaxPython,
+		"js":         syntaxJS,
+		"javascript": syntaxJS,
+		"jsx":        syntaxJS,
+		"ts":         syntaxJS,
+		"tsx":        syntaxJS,
+		"typescript": syntaxJS,
+		"rs":         syntaxRust,
+		"rust":       syntaxRust,
+		"c":          syntaxC,
+		"h":          syntaxC,
+		"cc":         syntaxC,
+		"cpp":        syntaxC,
+		"c++":        syntaxC,
+		"cs":         syntaxJava,
+		"csharp":     syntaxJava,
+		"java":       syntaxJava,
+		"kotlin":     syntaxJava,
+		"kt":         syntaxJava,
+		"bash":       syntaxShell,
+		"sh":         syntaxShell,
+		"shell":      syntaxShell,
+		"zsh":        syntaxShell,
+		"sql":        syntaxSQL,
+		"json":       syntaxData,
+		"yaml":       syntaxData,
+		"yml":        syntaxData,
+		"toml":       syntaxData,
+	}
+)
+
+// highlighter colors the lines of a code block.
+type highlighter struct {
+	s *syntax
+	// inComment is set while in a block comment.
+	inComment bool
+}
+
+// newHighlighter returns the highlighter for the language tag of a code block, or nil if unknown.
+func newHighlighter(lang string) *highlighter {
+	s := syntaxes[strings.ToLower(lang)]
+	if s == nil {
+		return nil
+	}
+	return &highlighter{s: s}
+}
+
+// line returns the line with ANSI escape sequences.
+func (h *highlighter) line(l string) string {
+	var b strings.Builder
+	i := 0
+	for i < len(l) {
+		if h.inComment {
+			end := strings.Index(l[i:], h.s.blockComment[1])
+			if end < 0 {
+				b.WriteString(styleComment + l[i:] + reset)
+				return b.String()
+			}
+			end += i + len(h.s.blockComment[1])
+			b.WriteString(styleComment + l[i:end] + reset)
+			i = end
+			h.inComment = false
+			continue
+		}
+		rest := l[i:]
+		if open := h.s.blockComment[0]; open != "" && strings.HasPrefix(rest, open) {
+			end := strings.Index(rest[len(open):], h.s.blockComment[1])
+			if end < 0 {
+				h.inComment = true
+				b.WriteString(styleComment + rest + reset)
+				return b.String()
+			}
+			end += len(open) + len(h.s.blockComment[1])
+			b.WriteString(styleComment + rest[:end] + reset)
+			i += end
+			continue
+		}
+		if h.isLineComment(rest) {
+			b.WriteString(styleComment + rest + reset)
+			return b.String()
+		}
+		c := l[i]
+		switch {
+		case strings.IndexByte(h.s.quotes, c) >= 0:
+			end := i + 1
+			for end < len(l) && l[end] != c {
+				if l[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(l))
+			b.WriteString(styleString + l[i:end] + reset)
+			i = end
+		case isIdentStart(c):
+			end := i + 1
+			for end < len(l) && (isIdentStart(l[end]) || isDigit(l[end])) {
+				end++
+			}
+			if w := l[i:end]; h.s.keywords[w] {
+				b.WriteString(styleKeyword + w + reset)
+			} else {
+				b.WriteString(w)
+			}
+			i = end
+		case isDigit(c):
+			end := i + 1
+			for end < len(l) && (isDigit(l[end]) || isIdentStart(l[end]) || l[end] == '.') {
+				end++
+			}
+			b.WriteString(styleNumber + l[i:end] + reset)
+			i = end
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+func (h *highlighter) isLineComment(s string) bool {
+	for _, p := range h.s.lineComments {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,130 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Subcommand history printing the prompts sent, which are logged unless -no-history.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxHistorySize is the size at which the history file is rotated. Only one previous file is kept.
+const maxHistorySize = 1 << 20
+
+// historyEntry is a line of the history file. The answer is not logged.
+type historyEntry struct {
+	Time     time.Time `json:"time"`
+	Provider string    `json:"provider"`
+	Model    string    `json:"model,omitzero"`
+	Prompt   string    `json:"prompt"`
+}
+
+// historyPath returns the history file in the XDG state directory.
+func historyPath() (string, error) {
+	d := os.Getenv("XDG_STATE_HOME")
+	if d == "" {
+		h, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		d = filepath.Join(h, ".local", "state")
+	}
+	return filepath.Join(d, "ask", "history"), nil
+}
+
+// appendHistory appends the entry to the history file, rotating it once it is too large.
+func appendHistory(e *historyEntry) error {
+	p, err := historyPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(p); err == nil && fi.Size() >= maxHistorySize {
+		if err := os.Rename(p, p+".1"); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	// The prompts may be sensitive.
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// readHistory returns the entries of the history file and the one rotated before it, oldest first.
+func readHistory() ([]historyEntry, error) {
+	p, err := historyPath()
+	if err != nil {
+		return nil, err
+	}
+	var out []historyEntry
+	for _, n := range []string{p + ".1", p} {
+		f, err := os.Open(n)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		s := bufio.NewScanner(f)
+		s.Buffer(nil, maxHistorySize)
+		for s.Scan() {
+			var e historyEntry
+			// Skip a line truncated by a crash.
+			if json.Unmarshal(s.Bytes(), &e) == nil {
+				out = append(out, e)
+			}
+		}
+		err = s.Err()
+		_ = f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func cmdHistory(args []string) error {
+	n := flag.Int("n", 10, "number of recent prompts to print")
+	_ = flag.CommandLine.Parse(args)
+	if flag.NArg() != 0 {
+		return errors.New("unexpected arguments")
+	}
+	if *n < 1 {
+		return errors.New("-n must be at least 1")
+	}
+	entries, err := readHistory()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries[max(0, len(entries)-*n):] {
+		m := e.Provider
+		if e.Model != "" {
+			m += "/" + e.Model
+		}
+		fmt.Printf("%s  %s  %s\n", e.Time.Local().Format("2006-01-02 15:04"), m, strings.ReplaceAll(e.Prompt, "\n", " "))
+	}
+	return nil
+}
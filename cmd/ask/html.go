@@ -0,0 +1,184 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Conversion of the markdown answer to sanitized HTML for -html and ask export -html.
+
+package main
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	reHeading = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	reBullet  = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	reOrdered = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	reRule    = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+)
+
+// markdownToHTML converts the common subset of markdown used by models to an HTML fragment.
+//
+// The output is sanitized by construction: all the text is escaped and only the tags generated here are
+// emitted, so raw HTML in the answer is shown as text. Links are only kept for http, https and mailto URLs.
+// The <details> and <summary> lines written by exportMarkdown around the reasoning are kept.
+func markdownToHTML(md string) string {
+	var out strings.Builder
+	var para []string
+	list := ""
+	flushPara := func() {
+		if len(para) != 0 {
+			out.WriteString("<p>" + renderInline(strings.Join(para, "\n")) + "</p>\n")
+			para = nil
+		}
+	}
+	closeList := func() {
+		if list != "" {
+			out.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+	openList := func(tag string) {
+		flushPara()
+		if list != tag {
+			closeList()
+			out.WriteString("<" + tag + ">\n")
+			list = tag
+		}
+	}
+	lines := strings.Split(strings.ReplaceAll(md, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		l := lines[i]
+		t := strings.TrimSpace(l)
+		if fence, ok := strings.CutPrefix(t, "```"); ok {
+			flushPara()
+			closeList()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			class := ""
+			if lang := strings.Fields(fence); len(lang) != 0 {
+				class = ` class="language-` + html.EscapeString(lang[0]) + `"`
+			}
+			out.WriteString("<pre><code" + class + ">" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+			continue
+		}
+		if t == "<details>" || t == "</details>" {
+			flushPara()
+			closeList()
+			out.WriteString(t + "\n")
+			continue
+		}
+		if s, ok := strings.CutPrefix(t, "<summary>"); ok && strings.HasSuffix(s, "</summary>") {
+			flushPara()
+			closeList()
+			out.WriteString("<summary>" + renderInline(strings.TrimSuffix(s, "</summary>")) + "</summary>\n")
+			continue
+		}
+		if t == "" {
+			flushPara()
+			closeList()
+			continue
+		}
+		if m := reHeading.FindStringSubmatch(t); m != nil {
+			flushPara()
+			closeList()
+			h := string(rune('0' + len(m[1])))
+			out.WriteString("<h" + h + ">" + renderInline(m[2]) + "</h" + h + ">\n")
+			continue
+		}
+		if reRule.MatchString(t) {
+			flushPara()
+			closeList()
+			out.WriteString("<hr>\n")
+			continue
+		}
+		if m := reBullet.FindStringSubmatch(l); m != nil {
+			openList("ul")
+			out.WriteString("<li>" + renderInline(m[1]) + "</li>\n")
+			continue
+		}
+		if m := reOrdered.FindStringSubmatch(l); m != nil {
+			openList("ol")
+			out.WriteString("<li>" + renderInline(m[1]) + "</li>\n")
+			continue
+		}
+		if q, ok := strings.CutPrefix(t, ">"); ok {
+			flushPara()
+			closeList()
+			out.WriteString("<blockquote>" + renderInline(strings.TrimSpace(q)) + "</blockquote>\n")
+			continue
+		}
+		closeList()
+		para = append(para, t)
+	}
+	flushPara()
+	closeList()
+	return out.String()
+}
+
+// renderInline converts the inline markdown: code spans, links, strong and emphasis.
+func renderInline(s string) string {
+	var out strings.Builder
+	for len(s) != 0 {
+		switch {
+		case s[0] == '`':
+			if j := strings.IndexByte(s[1:], '`'); j >= 0 {
+				out.WriteString("<code>" + html.EscapeString(s[1:1+j]) + "</code>")
+				s = s[2+j:]
+				continue
+			}
+		case s[0] == '[':
+			if text, url, rest, ok := cutLink(s); ok {
+				if isSafeURL(url) {
+					out.WriteString(`<a href="` + html.EscapeString(url) + `">` + renderInline(text) + "</a>")
+				} else {
+					out.WriteString(renderInline(text))
+				}
+				s = rest
+				continue
+			}
+		case strings.HasPrefix(s, "**") || strings.HasPrefix(s, "__"):
+			if j := strings.Index(s[2:], s[:2]); j > 0 {
+				out.WriteString("<strong>" + renderInline(s[2:2+j]) + "</strong>")
+				s = s[4+j:]
+				continue
+			}
+		case s[0] == '*' || s[0] == '_':
+			if j := strings.IndexByte(s[1:], s[0]); j > 0 {
+				out.WriteString("<em>" + renderInline(s[1:1+j]) + "</em>")
+				s = s[2+j:]
+				continue
+			}
+		case s[0] == '\n':
+			out.WriteString("<br>\n")
+			s = s[1:]
+			continue
+		}
+		out.WriteString(html.EscapeString(s[:1]))
+		s = s[1:]
+	}
+	return out.String()
+}
+
+// cutLink parses a "[text](url)" link at the start of s.
+func cutLink(s string) (text, url, rest string, ok bool) {
+	end := strings.Index(s, "](")
+	if end < 0 {
+		return "", "", "", false
+	}
+	closing := strings.IndexByte(s[end+2:], ')')
+	if closing < 0 {
+		return "", "", "", false
+	}
+	return s[1:end], strings.TrimSpace(s[end+2 : end+2+closing]), s[end+3+closing:], true
+}
+
+// isSafeURL returns true if the link cannot run code when clicked.
+func isSafeURL(u string) bool {
+	u = strings.ToLower(u)
+	return strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://") || strings.HasPrefix(u, "mailto:")
+}
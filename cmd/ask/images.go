@@ -0,0 +1,151 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Image generation options, sanity checks on the generated images and extraction of the images embedded in
+// the text.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"maps"
+	"math"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/maruel/genai"
+)
+
+// aspectSizes maps the supported aspect ratios to image dimensions.
+//
+// The long edge is 1024 pixels and both edges are multiples of 64, which is accepted by most image models.
+var aspectSizes = map[string][2]int{
+	"1:1":  {1024, 1024},
+	"4:3":  {1024, 768},
+	"3:4":  {768, 1024},
+	"16:9": {1024, 576},
+	"9:16": {576, 1024},
+}
+
+// parseAspect returns the image generation option for the aspect ratio.
+func parseAspect(s string) (*genai.GenOptionImage, error) {
+	size, ok := aspectSizes[s]
+	if !ok {
+		return nil, fmt.Errorf("invalid -aspect %q; supported values are %s", s, strings.Join(slices.Sorted(maps.Keys(aspectSizes)), ", "))
+	}
+	return &genai.GenOptionImage{Width: size[0], Height: size[1]}, nil
+}
+
+// checkAspect prints a warning when the image in b doesn't have the requested aspect ratio.
+//
+// Images in a format that cannot be decoded are silently ignored.
+func checkAspect(name string, b []byte, want *genai.GenOptionImage) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil || cfg.Height == 0 || want.Height == 0 {
+		return
+	}
+	got := float64(cfg.Width) / float64(cfg.Height)
+	if math.Abs(got-float64(want.Width)/float64(want.Height)) > 0.02 {
+		fmt.Fprintf(os.Stderr, "warning: %s is %dx%d; the model ignored the requested aspect ratio\n", name, cfg.Width, cfg.Height)
+	}
+}
+
+// maxExtractedImageSize is the maximum size of an image downloaded by -extract-images.
+const maxExtractedImageSize = 64 << 20
+
+// reMarkdownImage matches the markdown images embedded as a data URI or referenced by URL.
+var reMarkdownImage = regexp.MustCompile(`!\[([^\]]*)\]\((data:image/[\w.+-]+;base64,[A-Za-z0-9+/=\s]+|https?://[^\s)]+)\)`)
+
+// extractImages saves the markdown images in the text and returns the text referencing the saved files.
+//
+// Images that cannot be retrieved are kept as is. The saved files count towards -max-images.
+func extractImages(ctx context.Context, text string, w io.Writer, ro *requestOptions) string {
+	return reMarkdownImage.ReplaceAllStringFunc(text, func(m string) string {
+		if ro.maxImages != 0 && ro.saved >= ro.maxImages {
+			return m
+		}
+		sub := reMarkdownImage.FindStringSubmatch(m)
+		b, name, err := fetchImage(ctx, sub[2])
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "warning: failed to extract an image: %v\n", err)
+			return m
+		}
+		n := findAvailable(name)
+		_, _ = fmt.Fprintf(w, "- Writing %s\n", n)
+		if err := os.WriteFile(n, b, 0o644); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "warning: failed to extract an image: %v\n", err)
+			return m
+		}
+		ro.saved++
+		return "![" + sub[1] + "](" + filepath.ToSlash(n) + ")"
+	})
+}
+
+// fetchImage decodes a data URI or downloads an URL, returning the image and a file name for it.
+//
+// The URLs come from the answer, so they are not fetched with the provider's client which carries the API key.
+func fetchImage(ctx context.Context, src string) ([]byte, string, error) {
+	if rest, ok := strings.CutPrefix(src, "data:"); ok {
+		mimeType, data, _ := strings.Cut(rest, ";base64,")
+		b, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(data), ""))
+		if err != nil {
+			return nil, "", err
+		}
+		return b, "image" + imageExt(mimeType), nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, http.NoBody)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("got status code %d while retrieving %s", resp.StatusCode, src)
+	}
+	ct := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(ct, "image/") {
+		return nil, "", fmt.Errorf("%s is %q, not an image", src, ct)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxExtractedImageSize))
+	if err != nil {
+		return nil, "", err
+	}
+	name := path.Base(resp.Request.URL.Path)
+	if name == "/" || name == "." || path.Ext(name) == "" {
+		name = "image" + imageExt(ct)
+	}
+	return b, name, nil
+}
+
+// imageExt returns the file extension for the image mime type.
+func imageExt(mimeType string) string {
+	mt, _, _ := mime.ParseMediaType(mimeType)
+	switch mt {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/svg+xml":
+		return ".svg"
+	}
+	if exts, _ := mime.ExtensionsByType(mt); len(exts) != 0 {
+		return exts[0]
+	}
+	return ".img"
+}
@@ -10,14 +10,63 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
+	"net"
 	"os"
+
+	"github.com/maruel/ask/pkg/ask"
+	"github.com/maruel/httpjson"
 )
 
+// jsonErrors is set by -json-errors.
+var jsonErrors bool
+
+// jsonError is the error printed with -json-errors.
+type jsonError struct {
+	Error string `json:"error"`
+	// Type is one of "canceled", "http", "network", "tool" or "error".
+	Type string `json:"type"`
+	// Status is the HTTP status code returned by the provider, if any.
+	Status   int    `json:"status,omitzero"`
+	Provider string `json:"provider,omitzero"`
+	Model    string `json:"model,omitzero"`
+}
+
+// newJSONError categorizes err and adds the provider and model requested on the command line.
+func newJSONError(err error) *jsonError {
+	j := &jsonError{Error: err.Error(), Type: "error"}
+	var herr *httpjson.Error
+	var nerr net.Error
+	var terr *ask.ToolError
+	switch {
+	case errors.Is(err, context.Canceled):
+		j.Type = "canceled"
+	case errors.As(err, &herr):
+		j.Type = "http"
+		j.Status = herr.StatusCode
+	case errors.As(err, &terr):
+		j.Type = "tool"
+	case errors.As(err, &nerr):
+		j.Type = "network"
+	}
+	if f := flag.Lookup("provider"); f != nil {
+		j.Provider = f.Value.String()
+	}
+	if f := flag.Lookup("model"); f != nil {
+		j.Model = f.Value.String()
+	}
+	return j
+}
+
 func main() {
 	if err := Main(); err != nil {
-		if !errors.Is(err, context.Canceled) {
+		if jsonErrors {
+			b, _ := json.Marshal(newJSONError(err))
+			fmt.Fprintf(os.Stderr, "%s\n", b)
+		} else if !errors.Is(err, context.Canceled) {
 			fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
 		}
 		os.Exit(1)
@@ -0,0 +1,177 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Subcommand map running the prompts of a JSONL file concurrently.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/maruel/genai"
+	"golang.org/x/sync/errgroup"
+)
+
+// mapInput is one line of the input file.
+type mapInput struct {
+	// ID identifies the line in the output. Defaults to the line number.
+	ID     string `json:"id"`
+	Prompt string `json:"prompt"`
+	// Sys overrides -sys for this prompt.
+	Sys         string  `json:"sys"`
+	Temperature float64 `json:"temperature"`
+	MaxTokens   int64   `json:"max_tokens"`
+}
+
+// mapOutput is one line of the output file.
+type mapOutput struct {
+	ID           string `json:"id"`
+	Text         string `json:"text,omitzero"`
+	Error        string `json:"error,omitzero"`
+	InputTokens  int64  `json:"input_tokens,omitzero"`
+	OutputTokens int64  `json:"output_tokens,omitzero"`
+}
+
+func cmdMap(ctx context.Context, args []string) error {
+	var pf providerFlags
+	pf.register(ctx)
+	input := flag.String("f", "", "JSONL file with one {\"id\", \"prompt\", \"sys\", \"temperature\", \"max_tokens\"} object per line; - for stdin")
+	output := flag.String("o", "", "JSONL file to write the results to; defaults to stdout")
+	concurrency := flag.Int("concurrency", 4, "number of requests in flight")
+	systemPrompt := flag.String("sys", os.Getenv("ASK_SYSTEM_PROMPT"), "system prompt to use for the lines that do not specify one")
+	_ = flag.CommandLine.Parse(args)
+	if err := applyProfile(pf.profile); err != nil {
+		return err
+	}
+	if flag.NArg() != 0 {
+		return errors.New("unexpected arguments")
+	}
+	if *input == "" {
+		return errors.New("-f is required")
+	}
+	if *concurrency < 1 {
+		return errors.New("-concurrency must be at least 1")
+	}
+	var r io.Reader = os.Stdin
+	if *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		r = f
+	}
+	inputs, err := readMapInputs(r)
+	if err != nil {
+		return fmt.Errorf("%s: %w", *input, err)
+	}
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		w = f
+	}
+	c, err := pf.load(ctx)
+	if err != nil {
+		return err
+	}
+	defer pf.close()
+
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	failed := 0
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(*concurrency)
+	for i := range inputs {
+		eg.Go(func() error {
+			out := mapOnce(ctx, c, &inputs[i], *systemPrompt)
+			mu.Lock()
+			defer mu.Unlock()
+			if out.Error != "" {
+				failed++
+			}
+			// Failures of individual prompts are reported in the output; only failing to write stops the run.
+			return enc.Encode(&out)
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	if pf.errRR != nil {
+		return pf.errRR
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d out of %d prompts failed", failed, len(inputs))
+	}
+	return nil
+}
+
+// readMapInputs reads the JSONL prompts, skipping empty lines.
+func readMapInputs(r io.Reader) ([]mapInput, error) {
+	var inputs []mapInput
+	seen := map[string]int{}
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 16<<20)
+	for line := 1; s.Scan(); line++ {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		var in mapInput
+		if err := json.Unmarshal(s.Bytes(), &in); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if in.Prompt == "" {
+			return nil, fmt.Errorf("line %d: prompt is required", line)
+		}
+		if in.ID == "" {
+			in.ID = strconv.Itoa(line)
+		}
+		if prev, ok := seen[in.ID]; ok {
+			return nil, fmt.Errorf("line %d: id %q already used on line %d", line, in.ID, prev)
+		}
+		seen[in.ID] = line
+		inputs = append(inputs, in)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(inputs) == 0 {
+		return nil, errors.New("no prompts")
+	}
+	return inputs, nil
+}
+
+// mapOnce runs one prompt.
+func mapOnce(ctx context.Context, c genai.Provider, in *mapInput, systemPrompt string) mapOutput {
+	opt := genai.GenOptionText{SystemPrompt: systemPrompt, Temperature: in.Temperature, MaxTokens: in.MaxTokens}
+	if in.Sys != "" {
+		opt.SystemPrompt = in.Sys
+	}
+	var opts []genai.GenOption
+	if opt.SystemPrompt != "" || opt.Temperature != 0 || opt.MaxTokens != 0 {
+		opts = append(opts, &opt)
+	}
+	out := mapOutput{ID: in.ID}
+	res, err := c.GenSync(ctx, genai.Messages{genai.NewTextMessage(in.Prompt)}, opts...)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	out.Text = res.String()
+	out.InputTokens = res.Usage.InputTokens
+	out.OutputTokens = res.Usage.OutputTokens
+	return out
+}
@@ -0,0 +1,228 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Rendering of the markdown answer on the terminal, unless -raw.
+
+package main
+
+import (
+	"io"
+	"regexp"
+	"strings"
+)
+
+var (
+	reMDHeading = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	reMDList    = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	reMDRule    = regexp.MustCompile(`^\s*(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	reMDBold    = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	reMDCode    = regexp.MustCompile("`([^`]+)`")
+	reMDLink    = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	reMDTableSp = regexp.MustCompile(`^\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?$`)
+)
+
+// mdRenderer is an io.Writer rendering the markdown streamed to it with ANSI escape sequences: headings, bold,
+// inline code, links, lists, quotes, rules and tables.
+//
+// The text is rendered one line at a time, so each line is held until it is complete; tables are held until
+// their end to align the columns. Fenced code blocks are written as is, unless highlight is set and their
+// language is known. Flush must be called before writing something else to w and once done.
+type mdRenderer struct {
+	w         io.Writer
+	highlight bool
+	// style is the style of the text outside the code blocks, if any.
+	style string
+
+	line   []byte
+	inCode bool
+	hl     *highlighter
+	table  [][]string
+}
+
+func (m *mdRenderer) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) != 0 {
+		i := strings.IndexByte(string(p), '\n')
+		if i < 0 {
+			m.line = append(m.line, p...)
+			break
+		}
+		m.line = append(m.line, p[:i]...)
+		p = p[i+1:]
+		l := string(m.line)
+		m.line = m.line[:0]
+		if err := m.renderLine(l, true); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// Flush writes the partial line and the table held back.
+func (m *mdRenderer) Flush() error {
+	if len(m.line) != 0 {
+		l := string(m.line)
+		m.line = m.line[:0]
+		if err := m.renderLine(l, false); err != nil {
+			return err
+		}
+	}
+	return m.flushTable()
+}
+
+func (m *mdRenderer) renderLine(l string, eol bool) error {
+	nl := ""
+	if eol {
+		nl = "\n"
+	}
+	t := strings.TrimSpace(l)
+	if m.inCode || strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~") {
+		if err := m.flushTable(); err != nil {
+			return err
+		}
+		if strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~") {
+			m.inCode = !m.inCode
+			m.hl = nil
+			if f := strings.Fields(strings.TrimLeft(t, "`~")); m.inCode && m.highlight && len(f) != 0 {
+				m.hl = newHighlighter(f[0])
+			}
+			_, err := io.WriteString(m.w, styleDim+l+reset+nl)
+			return err
+		}
+		if m.hl != nil {
+			l = m.hl.line(l)
+		}
+		_, err := io.WriteString(m.w, l+nl)
+		return err
+	}
+	if strings.HasPrefix(t, "|") && eol {
+		m.table = append(m.table, splitTableRow(t))
+		return nil
+	}
+	if err := m.flushTable(); err != nil {
+		return err
+	}
+	var out string
+	if s := reMDHeading.FindStringSubmatch(l); s != nil {
+		style := m.style + bold
+		if len(s[1]) == 1 {
+			style += underline
+		}
+		out = style + renderInlineANSI(s[2], style) + reset
+	} else if reMDRule.MatchString(l) {
+		out = styleDim + strings.Repeat("─", 40) + reset
+	} else if s := reMDList.FindStringSubmatch(l); s != nil {
+		out = s[1] + "• " + renderInlineANSI(s[2], m.style)
+	} else if q, ok := strings.CutPrefix(t, ">"); ok {
+		out = styleDim + "│ " + reset + m.style + renderInlineANSI(strings.TrimSpace(q), m.style)
+	} else {
+		out = renderInlineANSI(l, m.style)
+	}
+	_, err := io.WriteString(m.w, paint(m.style, out)+nl)
+	return err
+}
+
+// flushTable writes the table held back with the columns aligned.
+func (m *mdRenderer) flushTable() error {
+	if len(m.table) == 0 {
+		return nil
+	}
+	rows := m.table
+	m.table = nil
+	var widths []int
+	for i, r := range rows {
+		if i == 1 && isTableSeparator(r) {
+			continue
+		}
+		for j, c := range r {
+			if i == 0 {
+				r[j] = m.style + bold + renderInlineANSI(c, m.style+bold) + reset
+			} else {
+				r[j] = paint(m.style, renderInlineANSI(c, m.style))
+			}
+			if j == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[j] = max(widths[j], visibleLen(r[j]))
+		}
+	}
+	var b strings.Builder
+	for i, r := range rows {
+		if i == 1 && isTableSeparator(r) {
+			for j, wd := range widths {
+				if j != 0 {
+					b.WriteString("─┼─")
+				}
+				b.WriteString(strings.Repeat("─", wd))
+			}
+			b.WriteString("\n")
+			continue
+		}
+		for j, wd := range widths {
+			if j != 0 {
+				b.WriteString(" │ ")
+			}
+			c := ""
+			if j < len(r) {
+				c = r[j]
+			}
+			b.WriteString(c + strings.Repeat(" ", wd-visibleLen(c)))
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(m.w, b.String())
+	return err
+}
+
+// splitTableRow returns the cells of a markdown table row.
+func splitTableRow(l string) []string {
+	l = strings.TrimSuffix(strings.TrimPrefix(l, "|"), "|")
+	// Escaped pipes are part of the cell.
+	cells := strings.Split(strings.ReplaceAll(l, `\|`, "\x00"), "|")
+	for i, c := range cells {
+		cells[i] = strings.ReplaceAll(strings.TrimSpace(c), "\x00", "|")
+	}
+	return cells
+}
+
+// visibleLen returns the number of runes of s, excluding the ANSI escape sequences.
+func visibleLen(s string) int {
+	n := 0
+	escape := false
+	for _, c := range s {
+		switch {
+		case escape:
+			// The sequence ends with a byte in the range @ to ~, except the [ introducer.
+			escape = !(c >= 0x40 && c <= 0x7e && c != '[')
+		case c == 0x1b:
+			escape = true
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+func isTableSeparator(r []string) bool {
+	return reMDTableSp.MatchString(strings.Join(r, "|"))
+}
+
+// renderInlineANSI renders the bold text, the inline code and the links of a line. style is the style to restore
+// after each element.
+func renderInlineANSI(s, style string) string {
+	// Render the code first so its content is left as is.
+	var codes []string
+	s = reMDCode.ReplaceAllStringFunc(s, func(c string) string {
+		codes = append(codes, styleCode+c[1:len(c)-1]+reset+style)
+		return "\x00"
+	})
+	s = reMDBold.ReplaceAllStringFunc(s, func(c string) string {
+		return bold + c[2:len(c)-2] + reset + style
+	})
+	s = reMDLink.ReplaceAllString(s, "${1}"+styleDim+" (${2})"+reset+style)
+	for _, c := range codes {
+		s = strings.Replace(s, "\x00", c, 1)
+	}
+	return s
+}
@@ -0,0 +1,135 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Subcommand matrix comparing the answers of providers and models to the same prompt.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/maruel/ask/pkg/ask"
+	"golang.org/x/sync/errgroup"
+)
+
+// matrixCell is the result of one provider and model combination.
+type matrixCell struct {
+	provider string
+	model    string
+	latency  time.Duration
+	input    int64
+	output   int64
+	answer   string
+	err      error
+}
+
+func cmdMatrix(ctx context.Context, args []string) error {
+	var pf providerFlags
+	pf.register(ctx)
+	provs := flag.String("providers", "", "comma separated providers to compare")
+	models := flag.String("models", "cheap,good", "comma separated models to compare on each provider; tiers like cheap, good and sota select the equivalent model of each provider")
+	concurrency := flag.Int("concurrency", 4, "number of requests in flight")
+	outDir := flag.String("out-dir", "", "directory to write the full answers to, one markdown file per provider and model")
+	width := flag.Int("width", 60, "maximum width of the answers in the table")
+	_ = flag.CommandLine.Parse(args)
+	if err := applyProfile(pf.profile); err != nil {
+		return err
+	}
+	prompt := strings.Join(flag.Args(), " ")
+	if prompt == "" {
+		return errors.New("provide a prompt as an argument")
+	}
+	if *provs == "" {
+		return errors.New("-providers is required")
+	}
+	if *concurrency < 1 {
+		return errors.New("-concurrency must be at least 1")
+	}
+	if *width < 4 {
+		return errors.New("-width must be at least 4")
+	}
+	// -provider and -model are ignored.
+	if err := pf.setup(); err != nil {
+		return err
+	}
+	defer pf.close()
+	if *outDir != "" {
+		if err := os.MkdirAll(*outDir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	var cells []matrixCell
+	for p := range strings.SplitSeq(*provs, ",") {
+		for m := range strings.SplitSeq(*models, ",") {
+			cells = append(cells, matrixCell{provider: strings.TrimSpace(p), model: strings.TrimSpace(m)})
+		}
+	}
+	// The requests share the -rate limiter. A failure is reported in the table instead of aborting the others.
+	var eg errgroup.Group
+	eg.SetLimit(*concurrency)
+	for i := range cells {
+		eg.Go(func() error {
+			cell := &cells[i]
+			c, err := pf.loadProviderModel(ctx, cell.provider, cell.model)
+			if err != nil {
+				cell.err = err
+				return nil
+			}
+			cell.model = c.ModelID()
+			start := time.Now()
+			res, err := ask.Run(ctx, ask.Options{Provider: c, Prompt: prompt})
+			cell.latency = time.Since(start)
+			cell.input = res.Usage.InputTokens
+			cell.output = res.Usage.OutputTokens
+			cell.answer = res.String()
+			cell.err = err
+			_, _ = fmt.Fprintf(os.Stderr, ".")
+			return nil
+		})
+	}
+	_ = eg.Wait()
+	_, _ = fmt.Fprintf(os.Stderr, "\n")
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if pf.errRR != nil {
+		return pf.errRR
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "Provider\tModel\tLatency\tIn\tOut\tAnswer\n")
+	for i := range cells {
+		cell := &cells[i]
+		answer := cell.answer
+		if cell.err != nil {
+			answer = "error: " + cell.err.Error()
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\n", cell.provider, cell.model, cell.latency.Round(time.Millisecond), cell.input, cell.output, truncate(answer, *width))
+		if *outDir != "" && cell.err == nil {
+			n := filepath.Join(*outDir, strings.NewReplacer("/", "_", ":", "_").Replace(cell.provider+"_"+cell.model)+".md")
+			if err := os.WriteFile(n, []byte(cell.answer), 0o644); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// truncate returns s on a single line, cut to width runes.
+func truncate(s string, width int) string {
+	r := []rune(strings.Join(strings.Fields(s), " "))
+	if len(r) <= width {
+		return string(r)
+	}
+	return string(r[:width-3]) + "..."
+}
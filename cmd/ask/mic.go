@@ -0,0 +1,157 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Recording of a spoken question from the microphone with -mic.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// maxMicDuration is the longest recording when -mic is stopped with Enter.
+const maxMicDuration = 5 * time.Minute
+
+// micFlag is -mic. "-mic" records until Enter is pressed and "-mic=N" records N seconds.
+type micFlag struct {
+	set bool
+	d   time.Duration
+}
+
+func (m *micFlag) IsBoolFlag() bool {
+	return true
+}
+
+func (m *micFlag) Set(v string) error {
+	if n, err := strconv.ParseFloat(v, 64); err == nil {
+		if n <= 0 || math.IsInf(n, 0) || math.IsNaN(n) {
+			return errors.New("must be a positive number of seconds")
+		}
+		m.set, m.d = true, time.Duration(n*float64(time.Second))
+		return nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return errors.New("must be a number of seconds")
+	}
+	m.set, m.d = b, 0
+	return nil
+}
+
+func (m *micFlag) String() string {
+	if m.d != 0 {
+		return strconv.FormatFloat(m.d.Seconds(), 'f', -1, 64)
+	}
+	return strconv.FormatBool(m.set)
+}
+
+// micCommand returns the command recording the default microphone to the WAV file out, in mono at 16kHz
+// which is enough for speech. It uses sox, ffmpeg or arecord, the first one found. d is 0 to record until
+// interrupted.
+func micCommand(ctx context.Context, out string, d time.Duration) (*exec.Cmd, error) {
+	secs := strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+	if _, err := exec.LookPath("rec"); err == nil {
+		args := []string{"-q", "-c", "1", "-r", "16000", out}
+		if d != 0 {
+			args = append(args, "trim", "0", secs)
+		}
+		return exec.CommandContext(ctx, "rec", args...), nil
+	}
+	if _, err := exec.LookPath("ffmpeg"); err == nil {
+		var input []string
+		switch runtime.GOOS {
+		case "darwin":
+			input = []string{"-f", "avfoundation", "-i", ":0"}
+		case "linux":
+			input = []string{"-f", "pulse", "-i", "default"}
+		}
+		if input != nil {
+			args := append([]string{"-loglevel", "error", "-nostdin"}, input...)
+			if d != 0 {
+				args = append(args, "-t", secs)
+			}
+			args = append(args, "-ac", "1", "-ar", "16000", "-y", out)
+			return exec.CommandContext(ctx, "ffmpeg", args...), nil
+		}
+	}
+	if _, err := exec.LookPath("arecord"); err == nil {
+		args := []string{"-q", "-f", "S16_LE", "-c", "1", "-r", "16000"}
+		if d != 0 {
+			// arecord only supports whole seconds.
+			args = append(args, "-d", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+		}
+		return exec.CommandContext(ctx, "arecord", append(args, out)...), nil
+	}
+	return nil, errors.New("-mic requires sox (rec), ffmpeg or arecord to record the microphone")
+}
+
+// recordMic records the microphone for d, or until Enter is pressed when d is 0, and returns the WAV file.
+// cleanup deletes it.
+func recordMic(ctx context.Context, d time.Duration) (string, func(), error) {
+	dir, err := os.MkdirTemp("", "ask-mic-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() {
+		_ = os.RemoveAll(dir)
+	}
+	out := filepath.Join(dir, "question.wav")
+	rctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if d == 0 {
+		rctx, cancel = context.WithTimeout(rctx, maxMicDuration)
+		defer cancel()
+	}
+	cmd, err := micCommand(rctx, out, d)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	// Interrupt the recorder so it finishes writing the file.
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = 5 * time.Second
+	cmd.Stderr = os.Stderr
+	if d == 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "%sRecording with %s; press Enter to stop.%s\n", styleDim, filepath.Base(cmd.Path), reset)
+	} else {
+		_, _ = fmt.Fprintf(os.Stderr, "%sRecording with %s for %s.%s\n", styleDim, filepath.Base(cmd.Path), d, reset)
+	}
+	if err := cmd.Start(); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	if d == 0 {
+		go func() {
+			_, _ = bufio.NewReader(os.Stdin).ReadString('\n')
+			cancel()
+		}()
+	}
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		cleanup()
+		return "", nil, ctx.Err()
+	}
+	// The recorder exits with an error when interrupted.
+	if err != nil && rctx.Err() == nil {
+		cleanup()
+		return "", nil, fmt.Errorf("recording the microphone: %w", err)
+	}
+	if fi, err := os.Stat(out); err != nil || fi.Size() == 0 {
+		cleanup()
+		return "", nil, errors.New("recording the microphone: nothing was recorded")
+	}
+	return out, cleanup, nil
+}
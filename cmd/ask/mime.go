@@ -0,0 +1,33 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Mime types of the media files that the OS database may not know about.
+
+package main
+
+import "mime"
+
+// extraMimeTypes are registered when the OS doesn't already know the extension.
+//
+// The mime type of a file passed with -f is determined by its extension. Go's builtin table is minimal and
+// the OS database is often missing in containers and on Windows, so audio recordings would otherwise be
+// rejected.
+var extraMimeTypes = map[string]string{
+	".aiff": "audio/aiff",
+	".m4a":  "audio/mp4",
+	".mp3":  "audio/mpeg",
+	".oga":  "audio/ogg",
+	".ogg":  "audio/ogg",
+	".opus": "audio/ogg",
+	".mp4":  "video/mp4",
+	".mov":  "video/quicktime",
+}
+
+func init() {
+	for ext, t := range extraMimeTypes {
+		if mime.TypeByExtension(ext) == "" {
+			_ = mime.AddExtensionType(ext, t)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Subcommand ocr extracting the text of images with a vision model.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/maruel/ask/pkg/ask"
+	"github.com/maruel/genai"
+)
+
+const ocrSystemPrompt = "Extract all the text in the image verbatim, preserving the reading order and the line breaks. " +
+	"Reply with only the extracted text, without any commentary nor formatting. Reply with nothing if there is no text."
+
+func cmdOCR(ctx context.Context, args []string) error {
+	var pf providerFlags
+	pf.register(ctx)
+	var files stringsFlag
+	flag.Var(&files, "f", "image(s) to extract the text from; can be specified multiple times; can be an URL")
+	output := flag.String("o", "", "file to write the text to; defaults to stdout")
+	_ = flag.CommandLine.Parse(args)
+	if err := applyProfile(pf.profile); err != nil {
+		return err
+	}
+	// Files can be listed as arguments to leverage shell globbing: ask ocr scans/*.png
+	files = append(files, flag.Args()...)
+	if len(files) == 0 {
+		return errors.New("provide images with -f")
+	}
+	c, err := pf.load(ctx)
+	if err != nil {
+		return err
+	}
+	defer pf.close()
+	if pf.model == "" {
+		if m := inputModel(c, genai.ModalityImage); m != "" && m != c.ModelID() {
+			if c, err = pf.loadModel(ctx, m); err != nil {
+				return err
+			}
+		}
+	}
+	var texts []string
+	for _, f := range files {
+		res, err := ask.Run(ctx, ask.Options{Provider: c, Prompt: "Extract the text of this image.", SystemPrompt: ocrSystemPrompt, Files: []string{f}})
+		if err != nil {
+			return fmt.Errorf("%s: %w", f, err)
+		}
+		texts = append(texts, strings.TrimSpace(res.String()))
+	}
+	if pf.errRR != nil {
+		return pf.errRR
+	}
+	out := strings.Join(texts, "\n\n") + "\n"
+	if *output != "" {
+		return os.WriteFile(*output, []byte(out), 0o644)
+	}
+	_, err = os.Stdout.WriteString(out)
+	return err
+}
+
+// inputModel returns the model to use to read the modality in, e.g. images.
+//
+// It is the current model when the provider's scoreboard lists it as accepting the modality, otherwise the
+// first model that does. It returns "" when the scoreboard lists none.
+func inputModel(c genai.Provider, in genai.Modality) string {
+	first := ""
+	sb := c.Scoreboard()
+	for i := range sb.Scenarios {
+		sc := &sb.Scenarios[i]
+		if _, ok := sc.In[in]; !ok {
+			continue
+		}
+		if _, ok := sc.Out[genai.ModalityText]; !ok {
+			continue
+		}
+		if slices.Contains(sc.Models, c.ModelID()) {
+			return c.ModelID()
+		}
+		if first == "" && len(sc.Models) != 0 {
+			first = sc.Models[0]
+		}
+	}
+	return first
+}
@@ -0,0 +1,96 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Selection of the files found in the directories and the glob patterns of -f with -pick.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/maruel/ask/pkg/ask"
+)
+
+// pickFiles replaces the directories and the glob patterns in files with the files the user selects among
+// the ones they contain, except the ones matching ignore and the ones larger than maxSize. The other files
+// are kept as is.
+func pickFiles(in io.Reader, w io.Writer, files, ignore []string, maxSize int64) ([]string, error) {
+	r := bufio.NewReader(in)
+	var out []string
+	for _, n := range files {
+		found, warnings, err := ask.ExpandFiles([]string{n}, ignore, maxSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, warning := range warnings {
+			_, _ = fmt.Fprintf(w, "warning: %s\n", warning)
+		}
+		if len(found) == 1 && found[0] == n {
+			out = append(out, n)
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "%s contains %d files:\n", n, len(found))
+		for i, f := range found {
+			_, _ = fmt.Fprintf(w, "%4d  %s\n", i+1, f)
+		}
+		for {
+			_, _ = fmt.Fprintf(w, "Files to attach, e.g. 1,3-5; Enter for all, none for none: ")
+			l, err := r.ReadString('\n')
+			if err != nil && (!errors.Is(err, io.EOF) || l == "") {
+				return nil, err
+			}
+			sel, err := parseSelection(l, len(found))
+			if err != nil {
+				_, _ = fmt.Fprintf(w, "%v\n", err)
+				continue
+			}
+			for _, i := range sel {
+				out = append(out, found[i])
+			}
+			break
+		}
+	}
+	return out, nil
+}
+
+// parseSelection returns the indexes, starting at 0, of the items selected among n by their numbers, starting
+// at 1, separated by commas or spaces, e.g. "1,3-5". An empty selection or "all" selects all the items, "none"
+// none of them.
+func parseSelection(s string, n int) ([]int, error) {
+	s = strings.TrimSpace(s)
+	var out []int
+	switch s {
+	case "", "all":
+		for i := range n {
+			out = append(out, i)
+		}
+		return out, nil
+	case "none":
+		return nil, nil
+	}
+	seen := make([]bool, n)
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		first, last, isRange := strings.Cut(f, "-")
+		a, err := strconv.Atoi(first)
+		b := a
+		if err == nil && isRange {
+			b, err = strconv.Atoi(last)
+		}
+		if err != nil || a < 1 || b < a || b > n {
+			return nil, fmt.Errorf("invalid selection %q; use numbers between 1 and %d", f, n)
+		}
+		for i := a - 1; i < b; i++ {
+			if !seen[i] {
+				seen[i] = true
+				out = append(out, i)
+			}
+		}
+	}
+	return out, nil
+}
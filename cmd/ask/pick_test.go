@@ -0,0 +1,59 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Tests of the selection of the files with -pick.
+
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseSelection(t *testing.T) {
+	data := []struct {
+		in   string
+		want []int
+	}{
+		{"", []int{0, 1, 2, 3}},
+		{"all\n", []int{0, 1, 2, 3}},
+		{"none", nil},
+		{"2", []int{1}},
+		{"1,3-4", []int{0, 2, 3}},
+		{"4 1 1-2", []int{3, 0, 1}},
+	}
+	for _, line := range data {
+		got, err := parseSelection(line.in, 4)
+		if err != nil || !slices.Equal(got, line.want) {
+			t.Errorf("%q: got %v, %v, want %v", line.in, got, err, line.want)
+		}
+	}
+	for _, in := range []string{"0", "5", "3-2", "1-", "a"} {
+		if _, err := parseSelection(in, 4); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
+
+func TestPickFiles(t *testing.T) {
+	d := t.TempDir()
+	for _, n := range []string{"a.go", "b.go", "c_test.go", "d.go"} {
+		if err := os.WriteFile(filepath.Join(d, n), []byte(n), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The invalid selection is asked again.
+	got, err := pickFiles(strings.NewReader("9\n1,3\n"), io.Discard, []string{"git:diff", d}, []string{"*_test.go"}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"git:diff", filepath.Join(d, "a.go"), filepath.Join(d, "d.go")}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Named profiles of flags loaded from the configuration file with -profile.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// config is the configuration file.
+//
+// Example:
+//
+//	# ~/.config/ask/config.yaml
+//	profiles:
+//	  work:
+//	    provider: anthropic
+//	    model: claude-sonnet-4-5
+//	    sys: You are an expert at software engineering.
+//	    shell: true
+//	    header: ["X-Team: data"]
+//	theme:
+//	  reasoning: faint
+//	cache:
+//	  enabled: true
+//	  ttl: 168h
+//
+// Each profile maps flag names, without the leading dash, to their value. A list sets a flag that can be
+// specified multiple times once per item.
+type config struct {
+	Profiles map[string]map[string]any `yaml:"profiles"`
+	Theme    theme                     `yaml:"theme"`
+	Cache    cacheConfig               `yaml:"cache"`
+}
+
+// configPath returns the configuration file in the user's configuration directory.
+func configPath() (string, error) {
+	d, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d, "ask", "config.yaml"), nil
+}
+
+// readConfig returns the configuration file and its path. The theme defaults to defaultTheme.
+func readConfig() (*config, string, error) {
+	p, err := configPath()
+	if err != nil {
+		return nil, "", err
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, p, err
+	}
+	cfg := &config{Theme: defaultTheme}
+	d := yaml.NewDecoder(bytes.NewReader(b))
+	d.KnownFields(true)
+	if err := d.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, p, fmt.Errorf("%s: %w", p, err)
+	}
+	return cfg, p, nil
+}
+
+// applyProfile sets the flags of the profile that were not specified on the command line.
+//
+// It must be called once the flags are parsed. Flags of the profile that the subcommand doesn't have are
+// ignored, so a profile can be shared by all the subcommands.
+func applyProfile(name string) error {
+	if name == "" {
+		return nil
+	}
+	cfg, p, err := readConfig()
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("-profile %s: %s doesn't exist", name, p)
+	}
+	if err != nil {
+		return err
+	}
+	prof, ok := cfg.Profiles[name]
+	if !ok {
+		return fmt.Errorf("%s: no profile %q; the profiles are %s", p, name, strings.Join(slices.Sorted(maps.Keys(cfg.Profiles)), ", "))
+	}
+	// An alias, e.g. -p, counts as its flag, e.g. -provider.
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[flagName(f)] = true
+	})
+	for _, k := range slices.Sorted(maps.Keys(prof)) {
+		f := flag.Lookup(k)
+		if f == nil {
+			slog.Debug("profile", "msg", "flag ignored by this command", "flag", k)
+			continue
+		}
+		if k == "profile" || k == "env-file" || k == "env-override" {
+			return fmt.Errorf("%s: profile %q: -%s cannot be set in a profile", p, name, k)
+		}
+		if set[flagName(f)] {
+			continue
+		}
+		values, ok := prof[k].([]any)
+		if !ok {
+			values = []any{prof[k]}
+		}
+		for _, v := range values {
+			if err := f.Value.Set(fmt.Sprint(v)); err != nil {
+				return fmt.Errorf("%s: profile %q: invalid value %v for -%s: %w", p, name, v, k, err)
+			}
+		}
+		set[flagName(f)] = true
+	}
+	return nil
+}
+
+// flagName returns the name of the flag an alias refers to, or the flag's name.
+func flagName(f *flag.Flag) string {
+	if n, ok := strings.CutPrefix(f.Usage, "(alias for -"); ok {
+		return strings.TrimSuffix(n, ")")
+	}
+	return f.Name
+}
@@ -0,0 +1,177 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Subcommand prompt managing the library of system prompts used with -prompt.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// promptExt is the extension of the files in the prompt library.
+const promptExt = ".md"
+
+// promptsDir returns the directory of the prompt library in the user's configuration directory.
+//
+// The files can be edited directly, or the directory shared with a team, e.g. as a git checkout.
+func promptsDir() (string, error) {
+	d, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d, "ask", "prompts"), nil
+}
+
+// promptPath returns the file of the saved prompt name.
+func promptPath(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid prompt name %q", name)
+	}
+	d, err := promptsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d, name+promptExt), nil
+}
+
+// loadPrompt returns the saved prompt name.
+func loadPrompt(name string) (string, error) {
+	p, err := promptPath(name)
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("-prompt %s: %s doesn't exist; see ask prompt list", name, p)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// listPrompts returns the names of the saved prompts, sorted.
+func listPrompts() ([]string, error) {
+	d, err := promptsDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(d)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, e := range entries {
+		if n, ok := strings.CutSuffix(e.Name(), promptExt); ok && !e.IsDir() && !strings.HasPrefix(n, ".") {
+			out = append(out, n)
+		}
+	}
+	slices.Sort(out)
+	return out, nil
+}
+
+func cmdPrompt(args []string) error {
+	usage := errors.New("usage: ask prompt list | save [-f file] [-force] <name> [text]")
+	if len(args) == 0 {
+		return usage
+	}
+	switch args[0] {
+	case "list":
+		return cmdPromptList(args[1:])
+	case "save":
+		return cmdPromptSave(args[1:])
+	default:
+		return usage
+	}
+}
+
+// cmdPromptList prints the saved prompts with their first line.
+func cmdPromptList(args []string) error {
+	_ = flag.CommandLine.Parse(args)
+	if flag.NArg() != 0 {
+		return errors.New("unexpected arguments")
+	}
+	names, err := listPrompts()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		d, _ := promptsDir()
+		_, _ = fmt.Fprintf(os.Stderr, "no prompt saved in %s; use ask prompt save <name>\n", d)
+		return nil
+	}
+	w := 0
+	for _, n := range names {
+		w = max(w, len(n))
+	}
+	for _, n := range names {
+		s, err := loadPrompt(n)
+		if err != nil {
+			return err
+		}
+		first, _, _ := strings.Cut(s, "\n")
+		fmt.Printf("%-*s  %s\n", w, n, first)
+	}
+	return nil
+}
+
+// cmdPromptSave saves the prompt from the arguments, the -f file or stdin.
+func cmdPromptSave(args []string) error {
+	file := flag.String("f", "", "file with the prompt to save; defaults to the arguments after the name or stdin")
+	force := flag.Bool("force", false, "overwrite the prompt if it was already saved")
+	_ = flag.CommandLine.Parse(args)
+	if flag.NArg() == 0 {
+		return errors.New("usage: ask prompt save [-f file] [-force] <name> [text]")
+	}
+	name := flag.Arg(0)
+	p, err := promptPath(name)
+	if err != nil {
+		return err
+	}
+	var b []byte
+	switch {
+	case flag.NArg() > 1:
+		if *file != "" {
+			return errors.New("cannot use -f with the prompt as arguments")
+		}
+		b = []byte(strings.Join(flag.Args()[1:], " "))
+	case *file != "":
+		if b, err = os.ReadFile(*file); err != nil {
+			return err
+		}
+	case stdinIsPiped():
+		if b, err = io.ReadAll(os.Stdin); err != nil {
+			return err
+		}
+	default:
+		return errors.New("specify the prompt as arguments, with -f or on stdin")
+	}
+	s := strings.TrimSpace(string(b))
+	if s == "" {
+		return errors.New("the prompt is empty")
+	}
+	if _, err := os.Stat(p); err == nil && !*force {
+		return fmt.Errorf("%s already exists; use -force to overwrite it", p)
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(p, []byte(s+"\n"), 0o600); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "saved %s\n", p)
+	return nil
+}
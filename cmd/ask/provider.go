@@ -0,0 +1,445 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Provider selection flags and loading, shared by all the subcommands.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/maruel/ask/internal"
+	"github.com/maruel/ask/pkg/ask"
+	"github.com/maruel/genai"
+	"github.com/maruel/genai/httprecord"
+	"github.com/maruel/genai/providers"
+	"github.com/maruel/genai/subprocessrecord"
+	"github.com/maruel/roundtrippers"
+	"gopkg.in/dnaeon/go-vcr.v4/pkg/recorder"
+)
+
+// providerFlags are the flags to select and connect to a provider.
+type providerFlags struct {
+	verbose  bool
+	record   string
+	provider string
+	fallback string
+	remote   string
+	model    string
+	modality string
+	rate     float64
+	// timeout is the maximum duration to load the provider, 0 meaning unlimited.
+	timeout  time.Duration
+	headers  stringsFlag
+	agent    string
+	cacert   string
+	insecure bool
+	profile  string
+	dump     string
+
+	// provOpts are the options shared by all the providers, set by load.
+	provOpts []genai.ProviderOption
+	limiter  *rateLimiter
+
+	rr *recorder.Recorder
+	// errRR is the error creating the HTTP recorder, which happens lazily when the provider creates its client.
+	errRR error
+	sr    *subprocessrecord.Recorder
+	// dumpFile is the file opened for -dump-request-json, if any.
+	dumpFile *os.File
+}
+
+// register registers the flags on flag.CommandLine.
+func (p *providerFlags) register(ctx context.Context) {
+	flag.BoolVar(&p.verbose, "v", false, "verbose logs about metadata and usage")
+	flag.StringVar(&p.profile, "profile", os.Getenv("ASK_PROFILE"), "named profile of flags to load from the configuration file, e.g. ~/.config/ask/config.yaml; the flags specified on the command line take precedence")
+	flag.StringVar(&p.record, "record", "", "record the HTTP requests in yaml files for inspection in the specified file.")
+	flag.StringVar(&p.provider, "p", "", "(alias for -provider)")
+	names := slices.Sorted(maps.Keys(providers.Available(ctx)))
+	flag.StringVar(&p.provider, "provider", os.Getenv("ASK_PROVIDER"), "backend to use: "+strings.Join(names, ", ")+"; a comma separated list tries the next ones like -provider-fallback")
+	flag.StringVar(&p.fallback, "provider-fallback", "", "comma separated providers to try in order when the provider fails with a transient error")
+	flag.StringVar(&p.remote, "r", "", "(alias for -remote)")
+	flag.StringVar(&p.remote, "remote", os.Getenv("ASK_REMOTE"), "URL to use to access the backend, useful for local model")
+	flag.DurationVar(&p.timeout, "provider-timeout", 30*time.Second, "maximum duration to connect to the provider and select the model, e.g. an unreachable -remote; 0 means unlimited; see -ttft-timeout for the request")
+	flag.Float64Var(&p.rate, "rate", 0, "maximum number of requests per second sent to the provider; 0 means unlimited")
+	flag.Var(&p.headers, "header", "HTTP header to add to the requests to the provider, e.g. \"X-Team: data\"; can be specified multiple times")
+	flag.StringVar(&p.agent, "user-agent", "", "User-Agent to use for the requests to the provider")
+	flag.StringVar(&p.cacert, "cacert", "", "PEM file with additional CA certificates to trust for the provider, e.g. for a -remote with a private CA")
+	flag.BoolVar(&p.insecure, "insecure", false, "skip the verification of the provider's TLS certificate; dangerous")
+	flag.StringVar(&p.dump, "dump-request-json", "", "write the HTTP requests sent to the provider as JSON, with the credentials redacted, to this file or \"-\" for stderr; the requests are still sent")
+	modelHelp := fmt.Sprintf("model ID to use, %q or %q to automatically select worse/better models, or an alias defined in ASK_MODEL_ALIASES; defaults to a %q model",
+		genai.ModelCheap, genai.ModelSOTA, genai.ModelGood)
+	flag.StringVar(&p.model, "m", "", "(alias for -model)")
+	flag.StringVar(&p.model, "model", os.Getenv("ASK_MODEL"), modelHelp)
+	modHelp := fmt.Sprintf("comma separated output modalities: %q, %q, %q, %q", genai.ModalityText, genai.ModalityAudio, genai.ModalityImage, genai.ModalityVideo)
+	flag.StringVar(&p.modality, "modality", "", modHelp)
+}
+
+// load connects to the provider selected by the flags.
+//
+// close must be called once the provider is not used anymore.
+func (p *providerFlags) load(ctx context.Context) (genai.Provider, error) {
+	if err := p.setup(); err != nil {
+		return nil, err
+	}
+	return p.loadModel(ctx, p.model)
+}
+
+// setup prepares the options shared by all the providers loaded.
+func (p *providerFlags) setup() error {
+	if p.verbose {
+		internal.Level.Set(slog.LevelDebug)
+	}
+	if p.rate < 0 {
+		return errors.New("-rate cannot be negative")
+	}
+	if p.timeout < 0 {
+		return errors.New("-provider-timeout cannot be negative")
+	}
+	if p.record != "" {
+		// Strip known extensions; the base is used for both .yaml and .ndjson.
+		for _, ext := range []string{".yaml", ".ndjson"} {
+			p.record = strings.TrimSuffix(p.record, ext)
+		}
+	}
+	public, secret, err := parseHeaders(p.headers)
+	if err != nil {
+		return err
+	}
+	if p.agent != "" {
+		public.Set("User-Agent", p.agent)
+	}
+	var tlsCfg *tls.Config
+	if p.cacert != "" || p.insecure {
+		if tlsCfg, err = p.tlsConfig(); err != nil {
+			return err
+		}
+	}
+	var dumpW io.Writer
+	switch p.dump {
+	case "":
+	case "-":
+		dumpW = os.Stderr
+	default:
+		if p.dumpFile, err = os.Create(p.dump); err != nil {
+			return err
+		}
+		dumpW = p.dumpFile
+	}
+	var provOpts []genai.ProviderOption
+	if p.verbose || p.record != "" || len(public) != 0 || len(secret) != 0 || tlsCfg != nil || dumpW != nil {
+		// HTTP providers. Only one transport wrapper is supported so it does everything.
+		provOpts = append(provOpts, genai.ProviderOptionTransportWrapper(func(h http.RoundTripper) http.RoundTripper {
+			if tlsCfg != nil {
+				h = withTLS(h, tlsCfg)
+			}
+			// Secrets are added below the recorder so they are never saved in the recordings.
+			if len(secret) != 0 {
+				h = &roundtrippers.Header{Transport: h, Header: secret}
+			}
+			if p.verbose {
+				h = &roundtrippers.Log{Transport: h, Logger: slog.Default()}
+			}
+			if p.record != "" {
+				// With -provider-fallback, all the providers share the same recording.
+				if p.rr == nil {
+					slog.Info("recording HTTP", "file", p.record+".yaml")
+					p.rr, p.errRR = httprecord.New(p.record, h)
+				}
+				h = p.rr
+			}
+			if len(public) != 0 {
+				h = &roundtrippers.Header{Transport: h, Header: public}
+			}
+			if dumpW != nil {
+				h = &dumpRequests{Transport: h, w: dumpW}
+			}
+			return h
+		}))
+		// CLI providers.
+		var wrappers []genai.ProviderOptionStarterWrapper
+		if p.verbose {
+			wrappers = append(wrappers, func(inner genai.Starter) genai.Starter {
+				return func(ctx context.Context, args []string) (io.WriteCloser, io.ReadCloser, func() error, error) {
+					slog.Info("subprocess start", "args", args)
+					stdin, stdout, wait, err := inner(ctx, args)
+					if err != nil {
+						return nil, nil, nil, err
+					}
+					return stdin, &logReader{ReadCloser: stdout}, wait, nil
+				}
+			})
+		}
+		if p.record != "" {
+			var err error
+			p.sr, err = subprocessrecord.New(p.record)
+			if err != nil {
+				return err
+			}
+			wrappers = append(wrappers, p.sr.Wrap)
+		}
+		provOpts = append(provOpts, genai.ProviderOptionStarterWrapper(func(s genai.Starter) genai.Starter {
+			for _, w := range wrappers {
+				s = w(s)
+			}
+			return s
+		}))
+	}
+	if p.modality != "" {
+		parts := strings.Split(p.modality, ",")
+		o := make(genai.Modalities, len(parts))
+		for i, s := range parts {
+			o[i] = genai.Modality(strings.TrimSpace(s))
+		}
+		provOpts = append(provOpts, genai.ProviderOptionModalities(o))
+	}
+	p.provOpts = provOpts
+	if p.rate > 0 {
+		p.limiter = newRateLimiter(p.rate)
+	}
+	return nil
+}
+
+// loadModel connects to the provider selected by the flags with a different model.
+//
+// load must have been called first.
+func (p *providerFlags) loadModel(ctx context.Context, model string) (genai.Provider, error) {
+	return p.loadProviderModel(ctx, p.provider, model)
+}
+
+// loadSpeech connects to a provider with a model generating audio, the one selected automatically when model
+// is empty.
+//
+// setup must have been called first.
+func (p *providerFlags) loadSpeech(ctx context.Context, provider, model string) (genai.Provider, error) {
+	opts := slices.DeleteFunc(slices.Clone(p.provOpts), func(o genai.ProviderOption) bool {
+		_, ok := o.(genai.ProviderOptionModalities)
+		return ok
+	})
+	opts = append(opts, genai.ProviderOptionModalities{genai.ModalityAudio})
+	if model != "" {
+		opts = append(opts, genai.ProviderOptionModel(model))
+	}
+	if p.remote != "" && provider == p.provider {
+		opts = append(opts, genai.ProviderOptionRemote(p.remote))
+	}
+	c, err := ask.LoadProvider(ctx, provider, opts...)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("loaded", "provider", c.Name(), "model", c.ModelID(), "modality", genai.ModalityAudio)
+	if p.limiter != nil {
+		c = &providerRateLimit{Provider: c, l: p.limiter}
+	}
+	return c, nil
+}
+
+// loadProviderModel connects to a provider with a model, with the options of the flags.
+//
+// setup must have been called first.
+func (p *providerFlags) loadProviderModel(ctx context.Context, provider, model string) (genai.Provider, error) {
+	m, err := resolveModelAlias(model)
+	if err != nil {
+		return nil, err
+	}
+	if m != model {
+		slog.Info("model alias", "alias", model, "model", m)
+		model = m
+	}
+	provOpts := p.provOpts
+	primaryOpts := slices.Clip(provOpts)
+	if model != "" {
+		primaryOpts = append(primaryOpts, genai.ProviderOptionModel(model))
+	}
+	if p.remote != "" {
+		primaryOpts = append(primaryOpts, genai.ProviderOptionRemote(p.remote))
+	}
+	// The context is only used while loading; the providers do not keep it.
+	lctx := ctx
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		lctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	// "-p a,b,c" is the same as "-p a -provider-fallback b,c".
+	var fallbacks []string
+	if before, after, ok := strings.Cut(provider, ","); ok {
+		provider = before
+		fallbacks = strings.Split(after, ",")
+	}
+	if p.fallback != "" {
+		fallbacks = append(fallbacks, strings.Split(p.fallback, ",")...)
+	}
+	var c genai.Provider
+	if len(fallbacks) == 0 {
+		c, err = ask.LoadProvider(lctx, provider, primaryOpts...)
+	} else {
+		// The model ID and the remote are specific to the primary provider. The fallback providers use the
+		// equivalent automatic model selection.
+		fallbackOpts := slices.Clip(provOpts)
+		if model != "" {
+			fallbackOpts = append(fallbackOpts, modelTier(model))
+		}
+		c, err = loadFallback(lctx, provider, primaryOpts, fallbacks, fallbackOpts)
+	}
+	if err != nil {
+		if ctx.Err() == nil && errors.Is(lctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("could not reach the provider within -provider-timeout %s: %w", p.timeout, err)
+		}
+		return nil, err
+	}
+	slog.Info("loaded", "provider", c.Name(), "model", c.ModelID())
+	if p.limiter != nil {
+		c = &providerRateLimit{Provider: c, l: p.limiter}
+	}
+	return c, nil
+}
+
+// tlsConfig returns the TLS configuration for -cacert and -insecure.
+func (p *providerFlags) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if p.cacert != "" {
+		b, err := os.ReadFile(p.cacert)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.RootCAs, err = x509.SystemCertPool(); err != nil {
+			cfg.RootCAs = x509.NewCertPool()
+		}
+		if !cfg.RootCAs.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no PEM certificate found in %s", p.cacert)
+		}
+	}
+	if p.insecure {
+		_, _ = fmt.Fprintf(os.Stderr, "WARNING: -insecure disables the verification of the provider's TLS certificate; the requests, including the API key, can be intercepted\n")
+		cfg.InsecureSkipVerify = true //nolint:gosec // Explicitly requested with -insecure.
+	}
+	return cfg, nil
+}
+
+// withTLS returns h using cfg for its connections.
+//
+// Only the provider's client is affected. The transports known to wrap the standard one are rebuilt; other
+// ones are replaced.
+func withTLS(h http.RoundTripper, cfg *tls.Config) http.RoundTripper {
+	switch t := h.(type) {
+	case *http.Transport:
+		t = t.Clone()
+		t.TLSClientConfig = cfg
+		return t
+	case *roundtrippers.Retry:
+		return &roundtrippers.Retry{Transport: withTLS(t.Transport, cfg), Policy: t.Policy}
+	default:
+		slog.Warn("tls", "msg", "replacing unknown transport", "type", fmt.Sprintf("%T", h))
+		return &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: cfg}
+	}
+}
+
+// resolveModelAlias returns the model ID for an alias.
+//
+// Aliases are defined in ASK_MODEL_ALIASES as comma separated name=model pairs, e.g.
+// "flash=gemini-2.5-flash,opus=claude-opus-4-1". The built-in aliases cheap, good and sota select the
+// equivalent tier of any provider. Other values are returned as is.
+func resolveModelAlias(model string) (string, error) {
+	if model == "" {
+		return "", nil
+	}
+	if v := os.Getenv("ASK_MODEL_ALIASES"); v != "" {
+		for _, a := range strings.Split(v, ",") {
+			k, m, ok := strings.Cut(a, "=")
+			k = strings.TrimSpace(k)
+			m = strings.TrimSpace(m)
+			if !ok || k == "" || m == "" {
+				return "", fmt.Errorf("invalid ASK_MODEL_ALIASES entry %q, expected name=model", a)
+			}
+			if k == model {
+				return m, nil
+			}
+		}
+	}
+	switch strings.ToLower(model) {
+	case "cheap":
+		return string(genai.ModelCheap), nil
+	case "good":
+		return string(genai.ModelGood), nil
+	case "sota":
+		return string(genai.ModelSOTA), nil
+	}
+	return model, nil
+}
+
+// parseHeaders parses "Name: value" headers, splitting the ones that look like they contain a secret.
+func parseHeaders(headers []string) (public, secret http.Header, err error) {
+	public = http.Header{}
+	secret = http.Header{}
+	for _, h := range headers {
+		k, v, ok := strings.Cut(h, ":")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" || strings.ContainsAny(k, " \t") {
+			return nil, nil, fmt.Errorf("invalid -header %q, expected \"Name: value\"", h)
+		}
+		dst := public
+		if isSecretHeader(k) {
+			dst = secret
+		}
+		dst.Add(k, strings.TrimSpace(v))
+	}
+	return public, secret, nil
+}
+
+// isSecretHeader returns true if the header name looks like it carries a credential.
+func isSecretHeader(k string) bool {
+	k = strings.ToLower(k)
+	for _, s := range []string{"auth", "cookie", "key", "password", "secret", "session", "token"} {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// close stops the recorders and closes the -dump-request-json file, if any.
+func (p *providerFlags) close() {
+	if p.dumpFile != nil {
+		if err := p.dumpFile.Close(); err != nil {
+			slog.Error("failed to close -dump-request-json file", "error", err)
+		}
+	}
+	if p.rr != nil {
+		if err := p.rr.Stop(); err != nil {
+			slog.Error("failed to stop HTTP recorder", "error", err)
+		}
+	}
+	if p.sr != nil {
+		if err := p.sr.Stop(); err != nil {
+			slog.Error("failed to stop subprocess recorder", "error", err)
+		}
+	}
+}
+
+// logReader wraps an io.ReadCloser and logs each chunk read from it.
+type logReader struct {
+	io.ReadCloser
+}
+
+func (l *logReader) Read(p []byte) (int, error) {
+	n, err := l.ReadCloser.Read(p)
+	if n > 0 {
+		slog.Debug("subprocess stdout", "data", strings.TrimRight(string(p[:n]), "\n"))
+	}
+	return n, err
+}
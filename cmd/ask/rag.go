@@ -0,0 +1,304 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Subcommand rag indexing files by chunks of text to send only the relevant ones with -rag.
+
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/maruel/ask/pkg/ask"
+)
+
+const ragPrompt = "Use the following excerpts of %s to answer when they are relevant, citing the files and the lines used.\n\n"
+
+// ragIndex is an index saved by ask rag index.
+type ragIndex struct {
+	// Provider and Model are the ones the embeddings were computed with, to compute the query's.
+	Provider string     `json:"provider"`
+	Model    string     `json:"model"`
+	Chunks   []ragChunk `json:"chunks"`
+}
+
+// ragChunk is a part of a file and its embedding.
+type ragChunk struct {
+	File string `json:"file"`
+	// Line is the first line of the chunk, starting at 1.
+	Line   int       `json:"line"`
+	Text   string    `json:"text"`
+	Vector []float64 `json:"vector"`
+}
+
+// scoredChunk is a chunk retrieved for a query.
+type scoredChunk struct {
+	*ragChunk
+	score float64
+}
+
+// ragPath returns the file of the index name.
+func ragPath(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid index name %q", name)
+	}
+	d, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d, "rag", name+".json"), nil
+}
+
+func loadRAGIndex(name string) (*ragIndex, error) {
+	p, err := ragPath(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("no index %q; create it with ask rag index -name %s <dir>", name, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	idx := &ragIndex{}
+	if err := json.Unmarshal(b, idx); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	return idx, nil
+}
+
+// splitLines splits the text in chunks of about size bytes at line boundaries and returns them with their
+// first line. A line longer than size is a chunk by itself.
+func splitLines(text string, size int) []ragChunk {
+	var out []ragChunk
+	var b strings.Builder
+	first, line := 1, 0
+	for l := range strings.Lines(text) {
+		line++
+		if b.Len() != 0 && b.Len()+len(l) > size {
+			out = append(out, ragChunk{Line: first, Text: b.String()})
+			b.Reset()
+			first = line
+		}
+		b.WriteString(l)
+	}
+	if strings.TrimSpace(b.String()) != "" {
+		out = append(out, ragChunk{Line: first, Text: b.String()})
+	}
+	return out
+}
+
+func cmdRAG(ctx context.Context, args []string) error {
+	usage := errors.New("usage: ask rag index [options] <dir> | query [options] <question>")
+	if len(args) == 0 {
+		return usage
+	}
+	switch args[0] {
+	case "index":
+		return cmdRAGIndex(ctx, args[1:])
+	case "query":
+		return cmdRAGQuery(ctx, args[1:])
+	default:
+		return usage
+	}
+}
+
+// cmdRAGIndex chunks and embeds the files and saves the index.
+func cmdRAGIndex(ctx context.Context, args []string) error {
+	var pf providerFlags
+	pf.register(ctx)
+	name := flag.String("name", "", "name of the index; defaults to the name of the first directory")
+	chunkSize := flag.Int("chunk-size", 2000, "size in bytes of the chunks of text embedded")
+	noCache := flag.Bool("no-cache", false, "do not read nor write the embeddings cache")
+	var ignore stringsFlag
+	flag.Var(&ignore, "ignore", "glob pattern of the files to skip; can be specified multiple times")
+	_ = flag.CommandLine.Parse(args)
+	if err := applyProfile(pf.profile); err != nil {
+		return err
+	}
+	if pf.provider == "" {
+		return errors.New("-provider is required")
+	}
+	if flag.NArg() == 0 {
+		return errors.New("provide the directories or the files to index")
+	}
+	if *chunkSize < 100 {
+		return errors.New("-chunk-size must be at least 100")
+	}
+	if *name == "" {
+		abs, err := filepath.Abs(flag.Arg(0))
+		if err != nil {
+			return err
+		}
+		*name = filepath.Base(abs)
+	}
+	p, err := ragPath(*name)
+	if err != nil {
+		return err
+	}
+	files, warnings, err := ask.ExpandFiles(flag.Args(), ignore, ask.DefaultMaxFileSize)
+	if err != nil {
+		return err
+	}
+	for _, w := range warnings {
+		_, _ = fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+	var chunks []ragChunk
+	for _, f := range files {
+		if isURL(f) || strings.HasPrefix(f, "git:") {
+			return fmt.Errorf("%s: only local files can be indexed", f)
+		}
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		if !utf8.Valid(b) {
+			_, _ = fmt.Fprintf(os.Stderr, "warning: %s: skipped, it is not text\n", f)
+			continue
+		}
+		for _, c := range splitLines(string(b), *chunkSize) {
+			c.File = f
+			chunks = append(chunks, c)
+		}
+	}
+	if len(chunks) == 0 {
+		return errors.New("no text found to index")
+	}
+	e, err := pf.loadEmbedder(ctx, pf.embedModel())
+	if err != nil {
+		return err
+	}
+	defer pf.close()
+	cache := ""
+	if !*noCache {
+		if d, err := os.UserCacheDir(); err == nil {
+			cache = filepath.Join(d, "ask", "embeddings")
+		}
+	}
+	inputs := make([]embedInput, len(chunks))
+	for i := range chunks {
+		inputs[i] = embedInput{id: chunks[i].File + ":" + strconv.Itoa(chunks[i].Line), text: chunks[i].Text}
+	}
+	vectors, err := e.embedCached(ctx, cache, inputs)
+	if err != nil {
+		return err
+	}
+	if pf.errRR != nil {
+		return pf.errRR
+	}
+	for i := range chunks {
+		chunks[i].Vector = vectors[i]
+	}
+	// The fallback providers are not recorded since the vectors of different models are not comparable.
+	provider, _, _ := strings.Cut(pf.provider, ",")
+	b, err := json.Marshal(&ragIndex{Provider: provider, Model: e.model, Chunks: chunks})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(p, b, 0o600); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "indexed %d chunks of %d files as %q; use ask -rag %s\n", len(chunks), len(files), *name, *name)
+	return nil
+}
+
+// cmdRAGQuery prints the chunks of the index the most relevant to the question.
+func cmdRAGQuery(ctx context.Context, args []string) error {
+	var pf providerFlags
+	pf.register(ctx)
+	name := flag.String("name", "", "name of the index")
+	k := flag.Int("k", 5, "number of chunks to print")
+	_ = flag.CommandLine.Parse(args)
+	if err := applyProfile(pf.profile); err != nil {
+		return err
+	}
+	if *name == "" {
+		return errors.New("-name is required")
+	}
+	if *k < 1 {
+		return errors.New("-k must be at least 1")
+	}
+	query := strings.Join(flag.Args(), " ")
+	if query == "" {
+		return errors.New("provide the question as arguments")
+	}
+	if err := pf.setup(); err != nil {
+		return err
+	}
+	defer pf.close()
+	results, err := pf.ragRetrieve(ctx, *name, query, *k)
+	if err != nil {
+		return err
+	}
+	if pf.errRR != nil {
+		return pf.errRR
+	}
+	for _, r := range results {
+		fmt.Printf("%s%.4f  %s:%d%s\n%s\n", styleDim, r.score, r.File, r.Line, reset, strings.TrimRight(r.Text, "\n"))
+	}
+	return nil
+}
+
+// ragRetrieve returns the k chunks of the index the most similar to the query, best first.
+//
+// setup must have been called first.
+func (p *providerFlags) ragRetrieve(ctx context.Context, name, query string, k int) ([]scoredChunk, error) {
+	idx, err := loadRAGIndex(name)
+	if err != nil {
+		return nil, err
+	}
+	c, err := p.loadProviderModel(ctx, idx.Provider, "")
+	if err != nil {
+		return nil, err
+	}
+	remote := ""
+	if idx.Provider == p.provider {
+		remote = p.remote
+	}
+	e, err := newEmbedder(c, remote, idx.Model, p.limiter)
+	if err != nil {
+		return nil, err
+	}
+	q, err := e.embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	results := make([]scoredChunk, len(idx.Chunks))
+	for i := range idx.Chunks {
+		results[i] = scoredChunk{&idx.Chunks[i], cosineSimilarity(q[0], idx.Chunks[i].Vector)}
+	}
+	slices.SortStableFunc(results, func(a, b scoredChunk) int {
+		return cmp.Compare(b.score, a.score)
+	})
+	return results[:min(k, len(results))], nil
+}
+
+// ragContext returns the chunks of the index the most relevant to the query, formatted for the system prompt.
+func ragContext(ctx context.Context, p *providerFlags, name, query string, k int) (string, error) {
+	results, err := p.ragRetrieve(ctx, name, query, k)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, ragPrompt, name)
+	for _, r := range results {
+		fmt.Fprintf(&b, "%s:%d\n%s", r.File, r.Line, fence(r.Text))
+	}
+	return strings.TrimRight(b.String(), "\n"), nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Token bucket rate limiting of provider requests.
+
+package main
+
+import (
+	"context"
+	"iter"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/maruel/genai"
+)
+
+// rateLimiter is a token bucket that is safe for concurrent use.
+//
+// Tokens are refilled at rate per second up to burst. A waiter that finds the bucket empty reserves a token
+// anyway and sleeps until it would have been available, so callers are served in order.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter allowing rate requests per second. The burst is the rate rounded up, so
+// that fractional rates still allow one request at a time.
+func newRateLimiter(rate float64) *rateLimiter {
+	burst := math.Max(1, math.Ceil(rate))
+	return &rateLimiter{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// wait blocks until a token is available or the context is canceled, which releases the token reserved.
+func (r *rateLimiter) wait(ctx context.Context) error {
+	r.mu.Lock()
+	now := time.Now()
+	r.tokens = math.Min(r.burst, r.tokens+now.Sub(r.last).Seconds()*r.rate)
+	r.last = now
+	r.tokens--
+	var d time.Duration
+	if r.tokens < 0 {
+		d = time.Duration(-r.tokens / r.rate * float64(time.Second))
+	}
+	r.mu.Unlock()
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		// Release the reserved token so the canceled request doesn't delay the next ones.
+		r.mu.Lock()
+		r.tokens = math.Min(r.burst, r.tokens+1)
+		r.mu.Unlock()
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// providerRateLimit wraps a Provider so every generation request first waits on the shared limiter.
+type providerRateLimit struct {
+	genai.Provider
+	l *rateLimiter
+}
+
+func (c *providerRateLimit) GenSync(ctx context.Context, msgs genai.Messages, opts ...genai.GenOption) (genai.Result, error) {
+	if err := c.l.wait(ctx); err != nil {
+		return genai.Result{}, err
+	}
+	return c.Provider.GenSync(ctx, msgs, opts...)
+}
+
+func (c *providerRateLimit) GenStream(ctx context.Context, msgs genai.Messages, opts ...genai.GenOption) (iter.Seq[genai.Reply], func() (genai.Result, error)) {
+	if err := c.l.wait(ctx); err != nil {
+		return func(func(genai.Reply) bool) {}, func() (genai.Result, error) { return genai.Result{}, err }
+	}
+	return c.Provider.GenStream(ctx, msgs, opts...)
+}
+
+func (c *providerRateLimit) GenAsync(ctx context.Context, msgs genai.Messages, opts ...genai.GenOption) (genai.Job, error) {
+	if err := c.l.wait(ctx); err != nil {
+		return "", err
+	}
+	return c.Provider.GenAsync(ctx, msgs, opts...)
+}
+
+func (c *providerRateLimit) Unwrap() genai.Provider {
+	return c.Provider
+}
@@ -0,0 +1,33 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Tests of the token bucket rate limiting.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterCanceled(t *testing.T) {
+	r := newRateLimiter(1)
+	if err := r.wait(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+	if err := r.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v", err)
+	}
+	// The canceled waiter released its token, so the next one waits for a single refill, not two.
+	r.mu.Lock()
+	tokens := r.tokens
+	r.mu.Unlock()
+	if tokens < -0.1 {
+		t.Fatalf("the canceled waiter kept its token: %f tokens", tokens)
+	}
+}
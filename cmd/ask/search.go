@@ -0,0 +1,171 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Subcommand search ranking files by semantic similarity to a query.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+func cmdSearch(ctx context.Context, args []string) error {
+	var pf providerFlags
+	pf.register(ctx)
+	query := flag.String("q", "", "query to search for")
+	k := flag.Int("k", 5, "number of results to print")
+	noCache := flag.Bool("no-cache", false, "do not read nor write the document embeddings cache")
+	var files stringsFlag
+	flag.Var(&files, "f", "file(s) to search; can be specified multiple times; a directory or a glob pattern like 'docs/**/*.md' searches the files found")
+	var ignore stringsFlag
+	flag.Var(&ignore, "ignore", "glob pattern of the files and directories to skip when -f is a directory or a glob pattern; can be specified multiple times")
+	_ = flag.CommandLine.Parse(args)
+	if err := applyProfile(pf.profile); err != nil {
+		return err
+	}
+	// Files can be listed as arguments to leverage shell globbing: ask search -q foo -f docs/*.txt
+	files = append(files, flag.Args()...)
+	if pf.provider == "" {
+		return errors.New("-provider is required")
+	}
+	if *query == "" {
+		return errors.New("-q is required")
+	}
+	if *k < 1 {
+		return errors.New("-k must be at least 1")
+	}
+	if len(files) == 0 {
+		return errors.New("provide files to search with -f")
+	}
+	inputs, err := readEmbedInputs(ctx, nil, files, ignore)
+	if err != nil {
+		return err
+	}
+	e, err := pf.loadEmbedder(ctx, pf.embedModel())
+	if err != nil {
+		return err
+	}
+	defer pf.close()
+	cache := ""
+	if !*noCache {
+		if d, err := os.UserCacheDir(); err == nil {
+			cache = filepath.Join(d, "ask", "embeddings")
+		}
+	}
+	vectors, err := e.embedCached(ctx, cache, inputs)
+	if err != nil {
+		return err
+	}
+	q, err := e.embed(ctx, []string{*query})
+	if err != nil {
+		return err
+	}
+	if pf.errRR != nil {
+		return pf.errRR
+	}
+	type result struct {
+		id    string
+		score float64
+	}
+	results := make([]result, len(inputs))
+	for i := range inputs {
+		results[i] = result{inputs[i].id, cosineSimilarity(q[0], vectors[i])}
+	}
+	slices.SortStableFunc(results, func(a, b result) int {
+		if a.score > b.score {
+			return -1
+		}
+		if a.score < b.score {
+			return 1
+		}
+		return 0
+	})
+	for _, r := range results[:min(*k, len(results))] {
+		fmt.Printf("%.4f  %s\n", r.score, r.id)
+	}
+	return nil
+}
+
+// embedCached returns the embeddings of the inputs, reusing the ones stored in the cache directory.
+//
+// Entries are keyed by the hash of the endpoint, the model and the content, so an edited file is embedded
+// again. The cache is disabled when dir is empty. It is private to the user since the embeddings leak the
+// content of the files.
+func (e *embedder) embedCached(ctx context.Context, dir string, inputs []embedInput) ([][]float64, error) {
+	out := make([][]float64, len(inputs))
+	paths := make([]string, len(inputs))
+	var missing []int
+	for i := range inputs {
+		if dir != "" {
+			h := sha256.New()
+			_, _ = fmt.Fprintf(h, "%s\x00%s\x00", e.url, e.model)
+			h.Write([]byte(inputs[i].text))
+			paths[i] = filepath.Join(dir, hex.EncodeToString(h.Sum(nil))+".json")
+			if b, err := os.ReadFile(paths[i]); err == nil && json.Unmarshal(b, &out[i]) == nil && len(out[i]) != 0 {
+				continue
+			}
+		}
+		missing = append(missing, i)
+	}
+	slog.DebugContext(ctx, "embeddings", "cached", len(inputs)-len(missing), "missing", len(missing))
+	if len(missing) == 0 {
+		return out, nil
+	}
+	texts := make([]string, len(missing))
+	for j, i := range missing {
+		texts[j] = inputs[i].text
+	}
+	v, err := e.embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, err
+		}
+	}
+	for j, i := range missing {
+		out[i] = v[j]
+		if dir == "" {
+			continue
+		}
+		b, err := json.Marshal(v[j])
+		if err != nil {
+			return nil, err
+		}
+		// The cache is best effort.
+		if err := os.WriteFile(paths[i], b, 0o600); err != nil {
+			slog.WarnContext(ctx, "embeddings", "path", paths[i], "err", err)
+		}
+	}
+	return out, nil
+}
+
+// cosineSimilarity returns the cosine of the angle between a and b, or 0 when they are not comparable.
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
@@ -0,0 +1,143 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Local HTTP server streaming the replies to a browser UI with -serve.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maruel/ask/pkg/ask"
+	"github.com/maruel/genai"
+)
+
+// serveRequest is the JSON body of a request to the -serve server.
+type serveRequest struct {
+	Prompt string `json:"prompt"`
+	// System overrides -sys when set.
+	System string `json:"sys"`
+}
+
+// serve answers the prompts POSTed to addr until the context is canceled.
+//
+// The reply is streamed as server-sent events: a "fragment" event per genai.Reply, then either a "done"
+// event with the usage or an "error" event. The tools are the ones enabled on the command line.
+func serve(ctx context.Context, addr string, c genai.Provider, base ask.Options) error {
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	port := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			serveAsk(w, r, c, base, port)
+		}),
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "Listening on http://%s\n", ln.Addr())
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(ln)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		return err
+	}
+	if err := <-done; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// serveAsk answers a request. port is the port the server listens on.
+func serveAsk(w http.ResponseWriter, r *http.Request, c genai.Provider, base ask.Options, port string) {
+	// Checking the Host header defeats DNS rebinding, where a web site resolves its own name to the loopback
+	// address to send prompts from the browser as a same origin request.
+	if !isLoopbackHost(r.Host, port) {
+		http.Error(w, "invalid Host header", http.StatusForbidden)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST a JSON request", http.StatusMethodNotAllowed)
+		return
+	}
+	// Requiring JSON forces a CORS preflight, so other web sites opened in the browser cannot send prompts.
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/json" {
+		http.Error(w, "expected Content-Type: application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	var req serveRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Prompt == "" {
+		http.Error(w, "prompt is required", http.StatusBadRequest)
+		return
+	}
+	o := base
+	o.Provider = c
+	o.Prompt = req.Prompt
+	if req.System != "" {
+		o.SystemPrompt = req.System
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	rc := http.NewResponseController(w)
+	send := func(event string, v any) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			slog.WarnContext(r.Context(), "serve", "event", event, "err", err)
+			return
+		}
+		_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+		_ = rc.Flush()
+	}
+	o.OnFragment = func(f genai.Reply) {
+		send("fragment", &f)
+	}
+	res, err := ask.Run(r.Context(), o)
+	if err != nil {
+		send("error", map[string]string{"error": err.Error()})
+		return
+	}
+	send("done", map[string]any{"usage": res.Usage})
+}
+
+// isLoopbackHost returns true if the Host header is localhost, 127.0.0.1 or [::1] with the port.
+func isLoopbackHost(host, port string) bool {
+	h, p, err := net.SplitHostPort(host)
+	if err != nil || p != port {
+		return false
+	}
+	switch strings.ToLower(h) {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	default:
+		return false
+	}
+}
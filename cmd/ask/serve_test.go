@@ -0,0 +1,44 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Tests of the -serve request validation.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ask/pkg/ask"
+)
+
+func TestServeAskHost(t *testing.T) {
+	data := []struct {
+		host string
+		want int
+	}{
+		{"evil.example:8080", http.StatusForbidden},
+		{"evil.example", http.StatusForbidden},
+		{"localhost:9999", http.StatusForbidden},
+		{"127.0.0.2:8080", http.StatusForbidden},
+		// The request is rejected after the Host check since the body is empty.
+		{"localhost:8080", http.StatusBadRequest},
+		{"127.0.0.1:8080", http.StatusBadRequest},
+		{"[::1]:8080", http.StatusBadRequest},
+	}
+	for _, l := range data {
+		t.Run(l.host, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}"))
+			r.Host = l.host
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			serveAsk(w, r, nil, ask.Options{}, "8080")
+			if w.Code != l.want {
+				t.Fatalf("got %d, want %d: %s", w.Code, l.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Conversations saved with -session and resumed with -continue.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/maruel/genai"
+)
+
+// lastSession is the session the conversations are saved to with -save when -session is not specified.
+const lastSession = "last"
+
+// sessionsDir returns the directory of the sessions in the XDG data directory.
+func sessionsDir() (string, error) {
+	d, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d, "sessions"), nil
+}
+
+// dataDir returns the directory of the data saved by ask in the XDG data directory.
+func dataDir() (string, error) {
+	d := os.Getenv("XDG_DATA_HOME")
+	if d == "" {
+		h, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		d = filepath.Join(h, ".local", "share")
+	}
+	return filepath.Join(d, "ask"), nil
+}
+
+// branchesSuffix is appended to the name of a session to save the other branches of a chat.
+const branchesSuffix = ".branches"
+
+// sessionPath returns the file of a session.
+func sessionPath(name string) (string, error) {
+	if name == "" || !filepath.IsLocal(name) || strings.ContainsAny(name, `/\`) || strings.HasSuffix(name, branchesSuffix) {
+		return "", fmt.Errorf("invalid session name %q", name)
+	}
+	d, err := sessionsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d, name+".json"), nil
+}
+
+// branchesPath returns the file of the other branches of a chat session.
+func branchesPath(name string) (string, error) {
+	p, err := sessionPath(name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(p, ".json") + branchesSuffix + ".json", nil
+}
+
+// loadSession returns the messages of a session. A session that doesn't exist is empty.
+func loadSession(name string) (genai.Messages, error) {
+	p, err := sessionPath(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var msgs genai.Messages
+	if err := json.Unmarshal(b, &msgs); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	return msgs, nil
+}
+
+// saveSession writes the messages of a session, including the content of the documents.
+func saveSession(name string, msgs genai.Messages) error {
+	p, err := sessionPath(name)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(msgs)
+	if err != nil {
+		return err
+	}
+	// The conversations may be sensitive.
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(p, b, 0o600)
+}
+
+// sessionBranches are the branches of a chat session. The session file holds the current branch, so ask
+// -session continues it, and the other ones are saved next to it.
+type sessionBranches struct {
+	Current  string                    `json:"current"`
+	Branches map[string]genai.Messages `json:"branches"`
+}
+
+// loadBranches returns the other branches of a session, or nil if there are none.
+func loadBranches(name string) (*sessionBranches, error) {
+	p, err := branchesPath(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sb := &sessionBranches{}
+	if err := json.Unmarshal(b, sb); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	return sb, nil
+}
+
+// saveBranches writes the other branches of a session. The file is deleted when there are none.
+func saveBranches(name string, sb *sessionBranches) error {
+	p, err := branchesPath(name)
+	if err != nil {
+		return err
+	}
+	if len(sb.Branches) == 0 {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	b, err := json.Marshal(sb)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(p, b, 0o600)
+}
+
+// latestSession returns the name of the session saved last, or "" if none.
+func latestSession() (string, error) {
+	d, err := sessionsDir()
+	if err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(d)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	name := ""
+	var newest time.Time
+	for _, e := range entries {
+		n, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || e.IsDir() || strings.HasSuffix(n, branchesSuffix) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			return "", err
+		}
+		if fi.ModTime().After(newest) {
+			name = n
+			newest = fi.ModTime()
+		}
+	}
+	return name, nil
+}
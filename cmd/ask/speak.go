@@ -0,0 +1,144 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Speech of the answer with -speak.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/maruel/genai"
+)
+
+var reMDFence = regexp.MustCompile("(?ms)^\\s*(```|~~~).*?^\\s*(```|~~~)\\s*$")
+
+// speechText returns the answer without the markdown markup, which would be read aloud. The code blocks are
+// skipped.
+func speechText(s string) string {
+	s = reMDFence.ReplaceAllString(s, "(code omitted)")
+	var lines []string
+	for l := range strings.Lines(s) {
+		l = strings.TrimRight(l, "\r\n")
+		if m := reMDHeading.FindStringSubmatch(l); m != nil {
+			l = m[2]
+		} else if m := reMDList.FindStringSubmatch(l); m != nil {
+			l = m[2]
+		} else if reMDRule.MatchString(l) || reMDTableSp.MatchString(strings.TrimSpace(l)) {
+			continue
+		}
+		l = strings.TrimLeft(l, "> ")
+		lines = append(lines, strings.ReplaceAll(l, "|", " "))
+	}
+	s = strings.Join(lines, "\n")
+	s = reMDLink.ReplaceAllString(s, "$1")
+	s = reMDBold.ReplaceAllString(s, "$1$2")
+	s = reMDCode.ReplaceAllString(s, "$1")
+	return strings.TrimSpace(s)
+}
+
+// speak writes the speech of the answer to a file in the current directory and plays it.
+//
+// load returns the provider generating the audio. It is nil to use the local engine, which is also used when
+// the provider fails.
+func speak(ctx context.Context, load func(ctx context.Context) (genai.Provider, error), answer string) error {
+	text := speechText(answer)
+	if text == "" {
+		return nil
+	}
+	var name string
+	var err error
+	if load != nil {
+		if name, err = speakProvider(ctx, load, text); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(os.Stderr, "warning: the provider could not generate the speech, using the local engine: %v\n", err)
+		}
+	}
+	if name == "" {
+		if name, err = speakLocal(ctx, text); err != nil {
+			return err
+		}
+	}
+	return playAudio(ctx, name)
+}
+
+// speakProvider generates the speech with the provider and writes it to a file.
+func speakProvider(ctx context.Context, load func(ctx context.Context) (genai.Provider, error), text string) (string, error) {
+	c, err := load(ctx)
+	if err != nil {
+		return "", err
+	}
+	res, err := c.GenSync(ctx, genai.Messages{genai.NewTextMessage(text)})
+	if err != nil {
+		return "", err
+	}
+	for i := range res.Replies {
+		r := &res.Replies[i]
+		if r.Doc.IsZero() {
+			continue
+		}
+		data, err := downloadDoc(c, r)
+		if err != nil {
+			return "", err
+		}
+		n := findAvailable(r.Doc.GetFilename())
+		_, _ = fmt.Fprintf(os.Stderr, "- Writing %s\n", n)
+		return n, os.WriteFile(n, data, 0o644)
+	}
+	return "", fmt.Errorf("%s didn't generate audio", c.ModelID())
+}
+
+// speakLocal generates the speech with the engine of the OS and writes it to a file.
+func speakLocal(ctx context.Context, text string) (string, error) {
+	var cmd *exec.Cmd
+	var n string
+	if _, err := exec.LookPath("say"); err == nil && runtime.GOOS == "darwin" {
+		n = findAvailable("answer.aiff")
+		cmd = exec.CommandContext(ctx, "say", "-o", n, "-f", "-")
+	} else {
+		for _, e := range []string{"espeak-ng", "espeak"} {
+			if _, err := exec.LookPath(e); err == nil {
+				n = findAvailable("answer.wav")
+				cmd = exec.CommandContext(ctx, e, "-w", n, "--stdin")
+				break
+			}
+		}
+	}
+	if cmd == nil {
+		return "", errors.New("-speak requires a provider generating audio, say or espeak-ng")
+	}
+	slog.InfoContext(ctx, "speak", "engine", cmd.Path)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stderr = os.Stderr
+	_, _ = fmt.Fprintf(os.Stderr, "- Writing %s\n", n)
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %w", cmd.Path, err)
+	}
+	return n, nil
+}
+
+// playAudio plays the file with the first player found. The file is kept when there is none.
+func playAudio(ctx context.Context, name string) error {
+	players := [][]string{{"afplay"}, {"paplay"}, {"aplay", "-q"}, {"play", "-q"}, {"ffplay", "-nodisp", "-autoexit", "-loglevel", "error"}}
+	for _, p := range players {
+		if _, err := exec.LookPath(p[0]); err != nil {
+			continue
+		}
+		cmd := exec.CommandContext(ctx, p[0], append(p[1:], name)...)
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "note: no audio player found to play %s\n", name)
+	return nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Live streaming statistics on stderr for -stats-live.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-colorable"
+)
+
+// liveStats is an io.Writer drawing the elapsed time and the approximate throughput on a stderr line while
+// the output is written to w.
+//
+// When w is the same terminal as stderr, the line is cleared before each write and only redrawn at the start
+// of a line, so it never splits the output. The throughput uses the usual approximation of 4 bytes per token.
+// Stop must be called once done.
+type liveStats struct {
+	w io.Writer
+	// shared is set when w is written to the terminal.
+	shared bool
+	stderr io.Writer
+	start  time.Time
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	mu          sync.Mutex
+	bytes       int
+	atLineStart bool
+	// decoAtLineStart is set when the last write to the decoration writer ended a line.
+	decoAtLineStart bool
+	drawn           bool
+	stopped         bool
+}
+
+func newLiveStats(w io.Writer, shared bool) *liveStats {
+	s := &liveStats{w: w, shared: shared, stderr: colorable.NewColorableStderr(), start: time.Now(), done: make(chan struct{}), atLineStart: true, decoAtLineStart: true}
+	s.wg.Go(func() {
+		t := time.NewTicker(250 * time.Millisecond)
+		defer t.Stop()
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-t.C:
+				s.mu.Lock()
+				s.draw()
+				s.mu.Unlock()
+			}
+		}
+	})
+	return s
+}
+
+func (s *liveStats) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shared {
+		s.clear()
+	}
+	n, err := s.w.Write(p)
+	s.bytes += n
+	if n != 0 {
+		s.atLineStart = p[n-1] == '\n'
+	}
+	s.draw()
+	return n, err
+}
+
+// Stop clears the line. The writes are passed through afterward.
+func (s *liveStats) Stop() {
+	close(s.done)
+	s.wg.Wait()
+	s.mu.Lock()
+	s.clear()
+	s.stopped = true
+	s.mu.Unlock()
+}
+
+func (s *liveStats) draw() {
+	if s.stopped || (s.shared && !s.atLineStart) || !s.decoAtLineStart {
+		return
+	}
+	d := time.Since(s.start)
+	_, _ = fmt.Fprintf(s.stderr, "\r\x1b[K%s%s  ~%.0f tokens/s%s", styleDim, d.Round(100*time.Millisecond), float64(s.bytes)/4/d.Seconds(), reset)
+	s.drawn = true
+}
+
+func (s *liveStats) clear() {
+	if s.drawn {
+		_, _ = io.WriteString(s.stderr, "\r\x1b[K")
+		s.drawn = false
+	}
+}
+
+// decoration returns a writer to stderr for the output that is not counted in the throughput. The line is
+// cleared before each write and only redrawn at the start of a line.
+func (s *liveStats) decoration() io.Writer {
+	return decorationWriter{s: s}
+}
+
+type decorationWriter struct {
+	s *liveStats
+}
+
+func (d decorationWriter) Write(p []byte) (int, error) {
+	d.s.mu.Lock()
+	defer d.s.mu.Unlock()
+	d.s.clear()
+	n, err := d.s.stderr.Write(p)
+	if n != 0 {
+		d.s.decoAtLineStart = p[n-1] == '\n'
+	}
+	d.s.draw()
+	return n, err
+}
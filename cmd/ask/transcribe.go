@@ -0,0 +1,171 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Subcommand transcribe converting the speech of audio and video files to text.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/maruel/ask/pkg/ask"
+	"github.com/maruel/genai"
+	"github.com/maruel/genai/base"
+)
+
+const transcribeSystemPrompt = "Transcribe the speech verbatim, in its original language, without translating it. " +
+	"Reply with only the transcript, without any commentary nor formatting. Reply with nothing if there is no speech."
+
+const transcribeSegmentsPrompt = "Transcribe the speech as segments of at most two sentences, one per line, formatted as " +
+	"[HH:MM:SS.mmm --> HH:MM:SS.mmm] text, where the timestamps are the start and the end of the segment in the file."
+
+var reSegment = regexp.MustCompile(`^\[?\s*(\d+(?::\d+){1,2}(?:[.,]\d+)?)\s*-->\s*(\d+(?::\d+){1,2}(?:[.,]\d+)?)\s*\]?\s*(.*)$`)
+
+// segment is a part of a transcript with its timing in milliseconds.
+type segment struct {
+	start, end int64
+	text       string
+}
+
+func cmdTranscribe(ctx context.Context, args []string) error {
+	var pf providerFlags
+	pf.register(ctx)
+	var files stringsFlag
+	flag.Var(&files, "f", "audio or video file(s) to transcribe; can be specified multiple times; can be an URL")
+	output := flag.String("o", "", "file to write the transcript to; defaults to stdout")
+	format := flag.String("format", "text", "format of the transcript: text, srt or vtt subtitles")
+	language := flag.String("language", "", "language spoken, e.g. fr, to help the model")
+	_ = flag.CommandLine.Parse(args)
+	if err := applyProfile(pf.profile); err != nil {
+		return err
+	}
+	// Files can be listed as arguments to leverage shell globbing: ask transcribe *.mp3
+	files = append(files, flag.Args()...)
+	if len(files) == 0 {
+		return errors.New("provide audio or video files with -f")
+	}
+	switch *format {
+	case "text", "srt", "vtt":
+	default:
+		return fmt.Errorf("-format must be text, srt or vtt, got %q", *format)
+	}
+	c, err := pf.load(ctx)
+	if err != nil {
+		return err
+	}
+	defer pf.close()
+	if pf.model == "" {
+		in := genai.ModalityAudio
+		if strings.HasPrefix(base.MimeByExt(filepath.Ext(files[0])), "video/") {
+			in = genai.ModalityVideo
+		}
+		if m := inputModel(c, in); m != "" && m != c.ModelID() {
+			if c, err = pf.loadModel(ctx, m); err != nil {
+				return err
+			}
+		}
+	}
+	sys := transcribeSystemPrompt
+	if *format != "text" {
+		sys += " " + transcribeSegmentsPrompt
+	}
+	if *language != "" {
+		sys += " The language spoken is " + *language + "."
+	}
+	var texts []string
+	for _, f := range files {
+		res, err := ask.Run(ctx, ask.Options{Provider: c, Prompt: "Transcribe this file.", SystemPrompt: sys, Files: []string{f}})
+		if err != nil {
+			return fmt.Errorf("%s: %w", f, err)
+		}
+		t := strings.TrimSpace(res.String())
+		if *format != "text" {
+			segs := parseSegments(t)
+			if len(segs) == 0 {
+				return fmt.Errorf("%s: the model didn't reply with timestamps; use -format text", f)
+			}
+			t = formatSubtitles(segs, *format)
+		}
+		texts = append(texts, t)
+	}
+	if pf.errRR != nil {
+		return pf.errRR
+	}
+	out := strings.Join(texts, "\n\n") + "\n"
+	if *output != "" {
+		return os.WriteFile(*output, []byte(out), 0o644)
+	}
+	_, err = os.Stdout.WriteString(out)
+	return err
+}
+
+// parseSegments parses the lines "[start --> end] text" of the reply. The other lines are skipped.
+func parseSegments(s string) []segment {
+	var out []segment
+	for l := range strings.Lines(s) {
+		m := reSegment.FindStringSubmatch(strings.TrimSpace(l))
+		if m == nil || strings.TrimSpace(m[3]) == "" {
+			continue
+		}
+		start, err1 := parseTimestamp(m[1])
+		end, err2 := parseTimestamp(m[2])
+		if err1 != nil || err2 != nil || end < start {
+			continue
+		}
+		out = append(out, segment{start: start, end: end, text: strings.TrimSpace(m[3])})
+	}
+	return out
+}
+
+// parseTimestamp parses [HH:]MM:SS[.mmm] in milliseconds.
+func parseTimestamp(s string) (int64, error) {
+	s = strings.Replace(s, ",", ".", 1)
+	secs, frac, _ := strings.Cut(s, ".")
+	var ms int64
+	if frac != "" {
+		frac = (frac + "00")[:3]
+		n, err := strconv.ParseInt(frac, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		ms = n
+	}
+	var t int64
+	for p := range strings.SplitSeq(secs, ":") {
+		n, err := strconv.ParseInt(p, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		t = t*60 + n
+	}
+	return t*1000 + ms, nil
+}
+
+// formatSubtitles formats the segments as SRT or WebVTT.
+func formatSubtitles(segs []segment, format string) string {
+	var b strings.Builder
+	sep := ","
+	if format == "vtt" {
+		sep = "."
+		b.WriteString("WEBVTT\n\n")
+	}
+	ts := func(ms int64) string {
+		return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+	}
+	for i, s := range segs {
+		if format == "srt" {
+			fmt.Fprintf(&b, "%d\n", i+1)
+		}
+		fmt.Fprintf(&b, "%s --> %s\n%s\n\n", ts(s.start), ts(s.end), s.text)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
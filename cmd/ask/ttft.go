@@ -0,0 +1,61 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Timeout waiting for the provider to start streaming the reply.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"time"
+
+	"github.com/maruel/genai"
+)
+
+// noResponseError is returned when the provider didn't start streaming in time.
+type noResponseError struct {
+	d time.Duration
+}
+
+func (e *noResponseError) Error() string {
+	return fmt.Sprintf("no response started within %s", e.d)
+}
+
+// providerTTFT wraps a Provider to cancel a streamed request when no fragment is received within d.
+//
+// Once the first fragment is received, the request is not limited anymore.
+type providerTTFT struct {
+	genai.Provider
+	d time.Duration
+}
+
+func (c *providerTTFT) GenStream(ctx context.Context, msgs genai.Messages, opts ...genai.GenOption) (iter.Seq[genai.Reply], func() (genai.Result, error)) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	t := time.AfterFunc(c.d, func() { cancel(&noResponseError{d: c.d}) })
+	fragments, finish := c.Provider.GenStream(ctx, msgs, opts...)
+	seq := func(yield func(genai.Reply) bool) {
+		for f := range fragments {
+			t.Stop()
+			if !yield(f) {
+				return
+			}
+		}
+	}
+	return seq, func() (genai.Result, error) {
+		t.Stop()
+		res, err := finish()
+		if cause := context.Cause(ctx); err != nil && cause != nil && !errors.Is(cause, context.Canceled) {
+			err = cause
+		}
+		cancel(nil)
+		return res, err
+	}
+}
+
+func (c *providerTTFT) Unwrap() genai.Provider {
+	return c.Provider
+}
@@ -0,0 +1,114 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Word wrapping of the streamed output for -wrap.
+
+package main
+
+import (
+	"io"
+	"strings"
+)
+
+// wordWrapper is an io.Writer wrapping the text at word boundaries as it is streamed.
+//
+// The last word of a write is held until the next one since it may continue. Fenced code blocks are not
+// wrapped and ANSI escape sequences are treated as zero width. Flush must be called once done.
+type wordWrapper struct {
+	w     io.Writer
+	width int
+
+	col    int
+	spaces int
+	word   []byte
+	// wordWidth is the number of runes in word, excluding the escape sequences.
+	wordWidth int
+	escape    bool
+	// line is the visible content of the current line, to detect the code fences.
+	line   strings.Builder
+	inCode bool
+}
+
+func (ww *wordWrapper) Write(p []byte) (int, error) {
+	for _, c := range p {
+		if err := ww.writeByte(c); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (ww *wordWrapper) writeByte(c byte) error {
+	switch {
+	case ww.escape:
+		ww.word = append(ww.word, c)
+		// The sequence ends with a byte in the range @ to ~, except the [ introducer.
+		if c >= 0x40 && c <= 0x7e && c != '[' {
+			ww.escape = false
+		}
+		return nil
+	case c == 0x1b:
+		ww.escape = true
+		ww.word = append(ww.word, c)
+		return nil
+	case c == '\n':
+		if err := ww.flushWord(); err != nil {
+			return err
+		}
+		if strings.HasPrefix(strings.TrimSpace(ww.line.String()), "```") {
+			ww.inCode = !ww.inCode
+		}
+		ww.line.Reset()
+		ww.col = 0
+		ww.spaces = 0
+		_, err := ww.w.Write([]byte{c})
+		return err
+	}
+	ww.line.WriteByte(c)
+	switch {
+	case ww.inCode:
+		_, err := ww.w.Write([]byte{c})
+		return err
+	case c == ' ':
+		if err := ww.flushWord(); err != nil {
+			return err
+		}
+		ww.spaces++
+		return nil
+	default:
+		ww.word = append(ww.word, c)
+		// Only count the first byte of each UTF-8 sequence.
+		if c&0xc0 != 0x80 {
+			ww.wordWidth++
+		}
+		return nil
+	}
+}
+
+// flushWord writes the pending spaces and word, breaking the line first if the word doesn't fit.
+func (ww *wordWrapper) flushWord() error {
+	if len(ww.word) == 0 {
+		return nil
+	}
+	var out []byte
+	if ww.col != 0 && ww.col+ww.spaces+ww.wordWidth > ww.width {
+		out = append(out, '\n')
+		ww.col = 0
+	} else {
+		out = append(out, strings.Repeat(" ", ww.spaces)...)
+		ww.col += ww.spaces
+	}
+	out = append(out, ww.word...)
+	ww.col += ww.wordWidth
+	ww.spaces = 0
+	ww.word = ww.word[:0]
+	ww.wordWidth = 0
+	_, err := ww.w.Write(out)
+	return err
+}
+
+// Flush writes the word held back.
+func (ww *wordWrapper) Flush() error {
+	return ww.flushWord()
+}
@@ -133,6 +133,10 @@ func cmdEnqueue(args []string) error {
 	if err != nil {
 		return err
 	}
+	// The job was created, so failing to register it is not fatal; get needs -provider then.
+	if err := registerJob(job, jobEntry{Provider: *provider, Model: c.ModelID(), Created: time.Now().UTC()}); err != nil {
+		slog.WarnContext(ctx, "registry", "err", err)
+	}
 	fmt.Printf("%s\n", job)
 	return nil
 }
@@ -144,7 +148,7 @@ func cmdGet(args []string) error {
 	names := listProviderGenAsync(ctx)
 	verbose := flag.Bool("v", false, "verbose")
 	poll := flag.Bool("poll", false, "poll until the results become available")
-	provider := flag.String("provider", "", "backend to use: "+strings.Join(names, ", "))
+	provider := flag.String("provider", "", "backend to use: "+strings.Join(names, ", ")+"; defaults to the one used to enqueue the job")
 	_ = flag.CommandLine.Parse(args)
 	if len(flag.Args()) != 1 {
 		return errors.New("pass only one argument: the job id")
@@ -161,7 +165,18 @@ func cmdGet(args []string) error {
 		}))
 	}
 	if *provider == "" {
-		return errors.New("-provider is required")
+		jobs, err := loadRegistry()
+		if err != nil {
+			return err
+		}
+		e, ok := jobs[job]
+		if !ok {
+			return errors.New("-provider is required for a job not enqueued from this computer")
+		}
+		*provider = e.Provider
+		if e.Model != "" {
+			popts = append(popts, genai.ProviderOptionModel(e.Model))
+		}
 	}
 	if !slices.Contains(names, *provider) {
 		return errors.New("unknown provider")
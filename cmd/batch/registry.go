@@ -0,0 +1,75 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Registry of the enqueued jobs, so get doesn't need the provider again.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/maruel/genai"
+)
+
+// jobEntry is what is known about an enqueued job.
+type jobEntry struct {
+	Provider string    `json:"provider"`
+	Model    string    `json:"model,omitzero"`
+	Created  time.Time `json:"created"`
+}
+
+// registryPath returns the file listing the enqueued jobs.
+func registryPath() (string, error) {
+	d, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d, "ask", "batch_jobs.json"), nil
+}
+
+// loadRegistry returns the enqueued jobs. It is empty when no job was ever enqueued.
+func loadRegistry() (map[genai.Job]jobEntry, error) {
+	p, err := registryPath()
+	if err != nil {
+		return nil, err
+	}
+	jobs := map[genai.Job]jobEntry{}
+	b, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return jobs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// registerJob records the provider and model used to enqueue the job.
+func registerJob(job genai.Job, e jobEntry) error {
+	jobs, err := loadRegistry()
+	if err != nil {
+		return err
+	}
+	jobs[job] = e
+	b, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	p, err := registryPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, b, 0o644)
+}
@@ -0,0 +1,87 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Subcommand assemble building a GIF from existing frames without calling the model.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/png"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/maruel/ask/internal"
+)
+
+func cmdAssemble(args []string, verbose *bool, filename *string, gf *gifFlags) error {
+	dir := flag.String("dir", "", "directory containing the PNG frames, assembled in the order of their names")
+	_ = flag.CommandLine.Parse(args)
+	if flag.NArg() != 0 {
+		return errors.New("unexpected arguments")
+	}
+	if *dir == "" {
+		return errors.New("-dir is required")
+	}
+	if *verbose {
+		internal.Level.Set(slog.LevelDebug)
+	}
+	opts, err := gf.options()
+	if err != nil {
+		return err
+	}
+	imgs, err := loadFrames(*dir)
+	if err != nil {
+		return err
+	}
+	imgs = resizeImages(trimImages(imgs), opts.size)
+	fmt.Printf("Creating %s from %d frames\n", *filename, len(imgs))
+	f, err := os.Create(*filename)
+	if err != nil {
+		return err
+	}
+	err = gif.EncodeAll(f, buildGIF(imgs, &opts))
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// loadFrames decodes the PNG files in dir, sorted by name.
+func loadFrames(dir string) ([]image.Image, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var imgs []image.Image
+	for _, e := range entries {
+		if e.IsDir() || !strings.EqualFold(filepath.Ext(e.Name()), ".png") {
+			continue
+		}
+		p := filepath.Join(dir, e.Name())
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		img, err := png.Decode(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		if len(imgs) != 0 && img.Bounds().Size() != imgs[0].Bounds().Size() {
+			return nil, fmt.Errorf("%s: is %s, expected %s like the previous frames", p, img.Bounds().Size(), imgs[0].Bounds().Size())
+		}
+		imgs = append(imgs, img)
+	}
+	if len(imgs) == 0 {
+		return nil, fmt.Errorf("no PNG files in %s", dir)
+	}
+	return imgs, nil
+}
@@ -11,6 +11,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"hash/fnv"
 	"image"
 	"image/color"
 	"image/color/palette"
@@ -21,6 +22,7 @@ import (
 	"log/slog"
 	"math"
 	"os"
+	"path/filepath"
 	"strings"
 	"unicode"
 
@@ -65,7 +67,16 @@ func runAsync(ctx context.Context, c *gemini.Client, msgs genai.Messages, opts .
 	return res.Message, err
 }
 
-func run(ctx context.Context, query, filename string) error {
+// output selects the files written from the generated frames.
+type output struct {
+	// gif is the animated GIF to write; empty to skip it.
+	gif string
+	// framesDir is the directory to write the trimmed frames as numbered PNGs to; empty to skip them.
+	framesDir string
+	opts      gifOptions
+}
+
+func run(ctx context.Context, query string, out output, seed int64) error {
 	cBase, err := gemini.New(ctx, genai.ProviderOptionModel("gemini-2.5-flash"))
 	if err != nil {
 		return err
@@ -77,7 +88,7 @@ func run(ctx context.Context, query, filename string) error {
 			SystemPrompt: systemPrompt,
 			Temperature:  1,
 		},
-		genai.GenOptionSeed(1),
+		genai.GenOptionSeed(seed),
 	}
 	msg, err := runSync(ctx, cBase, msgs, opts...)
 	if err != nil {
@@ -107,7 +118,7 @@ func run(ctx context.Context, query, filename string) error {
 		&genai.GenOptionText{
 			Temperature: 1,
 		},
-		genai.GenOptionSeed(1),
+		genai.GenOptionSeed(seed),
 		&gemini.GenOption{ThinkingBudget: 0},
 	}
 	cImg, err := gemini.New(ctx,
@@ -164,29 +175,191 @@ func run(ctx context.Context, query, filename string) error {
 	if len(imgs) == 0 {
 		return nil
 	}
-	imgs = trimImages(imgs)
-	// Accumulate the images, save as a GIF.
-	g := gif.GIF{
+	imgs = resizeImages(trimImages(imgs), out.opts.size)
+	if out.framesDir != "" {
+		names, err2 := writeFrames(out.framesDir, imgs)
+		if err2 != nil {
+			return err2
+		}
+		fmt.Printf("Frames:\n")
+		for _, n := range names {
+			fmt.Printf("- %s\n", n)
+		}
+	}
+	if out.gif == "" {
+		return nil
+	}
+	fmt.Printf("Creating %s\n", out.gif)
+	f, err := os.Create(out.gif)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	return gif.EncodeAll(f, buildGIF(imgs, &out.opts))
+}
+
+// gifOptions controls how the frames are encoded.
+type gifOptions struct {
+	// delay is the time each frame is shown, in 100ths of a second.
+	delay int
+	// loop is the number of times the animation is repeated; 0 loops forever and -1 plays it once.
+	loop int
+	// size is the maximum width and height of the frames; 0 keeps the size.
+	size    int
+	palette color.Palette
+	// optimize is set to only encode the region that changed in each frame.
+	optimize bool
+}
+
+// gifFlags are the flags controlling the GIF encoding, shared by the subcommands.
+type gifFlags struct {
+	delay    int
+	loop     int
+	size     int
+	palette  string
+	optimize bool
+}
+
+func (g *gifFlags) register() {
+	flag.IntVar(&g.delay, "delay", 100, "time each frame is shown, in 100ths of a second")
+	flag.IntVar(&g.loop, "loop", 0, "number of times the animation is repeated; 0 loops forever and -1 plays it once")
+	flag.IntVar(&g.size, "size", 0, "maximum width and height of the frames, scaling them down as needed; 0 keeps the size")
+	flag.StringVar(&g.palette, "palette", "plan9", "GIF palette: plan9 or websafe")
+	flag.BoolVar(&g.optimize, "optimize", false, "only encode the region that changed in each frame to shrink the GIF")
+}
+
+// options validates the flags.
+func (g *gifFlags) options() (gifOptions, error) {
+	o := gifOptions{delay: g.delay, loop: g.loop, size: g.size, optimize: g.optimize}
+	if g.delay < 0 {
+		return o, errors.New("-delay cannot be negative")
+	}
+	if g.loop < -1 {
+		return o, errors.New("-loop must be at least -1")
+	}
+	if g.size < 0 {
+		return o, errors.New("-size cannot be negative")
+	}
+	switch g.palette {
+	case "plan9":
+		o.palette = palette.Plan9
+	case "websafe":
+		o.palette = palette.WebSafe
+	default:
+		return o, fmt.Errorf("invalid -palette %q; supported values are plan9, websafe", g.palette)
+	}
+	return o, nil
+}
+
+// buildGIF accumulates the images as an animated GIF.
+//
+// The frames are opaque and kept in place (DisposalNone), so when optimize is set, each frame after the first
+// only encodes the region that changed from the previous one. It decodes to the same frames.
+func buildGIF(imgs []image.Image, opts *gifOptions) *gif.GIF {
+	g := &gif.GIF{
 		Config: image.Config{
-			ColorModel: color.Palette(palette.Plan9),
+			ColorModel: opts.palette,
 			Width:      imgs[0].Bounds().Dx(),
 			Height:     imgs[0].Bounds().Dy(),
 		},
+		LoopCount: opts.loop,
 	}
+	var prev *image.Paletted
 	for i := range imgs {
 		b := imgs[i].Bounds()
-		pm := image.NewPaletted(b, palette.Plan9)
+		pm := image.NewPaletted(b, opts.palette)
 		draw.FloydSteinberg.Draw(pm, b, imgs[i], b.Min)
-		g.Image = append(g.Image, pm)
-		g.Delay = append(g.Delay, 100)
+		frame := pm
+		if opts.optimize && prev != nil {
+			if sub, ok := pm.SubImage(changedRect(prev, pm)).(*image.Paletted); ok {
+				frame = sub
+			}
+		}
+		prev = pm
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, opts.delay)
+		g.Disposal = append(g.Disposal, gif.DisposalNone)
 	}
-	fmt.Printf("Creating %s\n", filename)
-	f, err := os.Create(filename)
-	if err != nil {
-		return err
+	return g
+}
+
+// resizeImages scales the images down with nearest neighbor sampling so they fit in a size x size square.
+//
+// The images are returned as is when size is 0 or they already fit.
+func resizeImages(imgs []image.Image, size int) []image.Image {
+	if size <= 0 || len(imgs) == 0 {
+		return imgs
 	}
-	defer func() { _ = f.Close() }()
-	return gif.EncodeAll(f, &g)
+	b := imgs[0].Bounds()
+	scale := min(float64(size)/float64(b.Dx()), float64(size)/float64(b.Dy()))
+	if scale >= 1 {
+		return imgs
+	}
+	w, h := max(1, int(float64(b.Dx())*scale)), max(1, int(float64(b.Dy())*scale))
+	out := make([]image.Image, len(imgs))
+	for i, img := range imgs {
+		src := img.Bounds()
+		dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+		for y := range h {
+			for x := range w {
+				dst.Set(x, y, img.At(src.Min.X+x*src.Dx()/w, src.Min.Y+y*src.Dy()/h))
+			}
+		}
+		out[i] = dst
+	}
+	return out
+}
+
+// changedRect returns the smallest rectangle containing the pixels that differ between a and b, which must
+// have the same bounds.
+//
+// A GIF frame cannot be empty, so a single pixel is returned when the images are identical.
+func changedRect(a, b *image.Paletted) image.Rectangle {
+	r := image.Rectangle{}
+	bounds := b.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if a.ColorIndexAt(x, y) != b.ColorIndexAt(x, y) {
+				r = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	if r.Empty() {
+		return image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Min.X+1, bounds.Min.Y+1)
+	}
+	return r
+}
+
+// writeFrames writes the frames as numbered PNGs in dir and returns their paths.
+func writeFrames(dir string, imgs []image.Image) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	names := make([]string, len(imgs))
+	for i, img := range imgs {
+		names[i] = filepath.Join(dir, fmt.Sprintf("frame%02d.png", i))
+		f, err := os.Create(names[i])
+		if err != nil {
+			return nil, err
+		}
+		err = png.Encode(f, img)
+		if err2 := f.Close(); err == nil {
+			err = err2
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+// querySeed returns a seed derived from the query, so each subject is reproducible yet distinct.
+//
+// It is kept within the positive int32 range accepted by the API.
+func querySeed(query string) int64 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(query))
+	return int64(h.Sum32() & math.MaxInt32)
 }
 
 // trimImages detects borders on all sides and trims them.
@@ -319,6 +492,21 @@ func mainImpl() error {
 
 	verbose := flag.Bool("v", false, "verbose")
 	filename := flag.String("out", "doodle.gif", "result file")
+	var gf gifFlags
+	gf.register()
+	if len(os.Args) > 1 && os.Args[1] == "assemble" {
+		return cmdAssemble(os.Args[2:], verbose, filename, &gf)
+	}
+	framesOnly := flag.Bool("frames-only", false, "write the trimmed frames as numbered PNGs in -frames-dir instead of the GIF")
+	alsoFrames := flag.Bool("also-frames", false, "write the trimmed frames as numbered PNGs in -frames-dir in addition to the GIF")
+	framesDir := flag.String("frames-dir", "frames", "directory to write the frames to with -frames-only or -also-frames")
+	seed := flag.Int64("seed", 0, "seed used for both the prompt and the images generation; defaults to a hash of the query")
+	flag.Usage = func() {
+		w := flag.CommandLine.Output()
+		_, _ = fmt.Fprintf(w, "Usage: %s [options] <subject>\n", os.Args[0])
+		_, _ = fmt.Fprintf(w, "       %s assemble [options] -dir <frames>\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 	if flag.NArg() != 1 {
 		return errors.New("ask something to doodle, e.g. \"a shiba inu eating ice-cream\"")
@@ -326,8 +514,26 @@ func mainImpl() error {
 	if *verbose {
 		internal.Level.Set(slog.LevelDebug)
 	}
+	if *framesOnly && *alsoFrames {
+		return errors.New("use only one of -frames-only and -also-frames")
+	}
+	opts, err := gf.options()
+	if err != nil {
+		return err
+	}
+	out := output{gif: *filename, opts: opts}
+	if *framesOnly || *alsoFrames {
+		out.framesDir = *framesDir
+	}
+	if *framesOnly {
+		out.gif = ""
+	}
 	query := flag.Arg(0)
-	return run(ctx, query, *filename)
+	if *seed == 0 {
+		*seed = querySeed(query)
+	}
+	fmt.Printf("Seed is %d\n", *seed)
+	return run(ctx, query, out, *seed)
 }
 
 func main() {
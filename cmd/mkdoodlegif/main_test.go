@@ -0,0 +1,72 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Tests of the GIF encoding.
+
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"testing"
+)
+
+func TestBuildGIFOptimize(t *testing.T) {
+	// A square moving on a gradient, with an identical frame in the middle.
+	var imgs []image.Image
+	for _, x := range []int{4, 20, 20, 36} {
+		img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+		for y := range 48 {
+			for x := range 64 {
+				img.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 5), 128, 255})
+			}
+		}
+		draw.Draw(img, image.Rect(x, 10, x+12, 22), image.NewUniform(color.RGBA{255, 0, 0, 255}), image.Point{}, draw.Src)
+		imgs = append(imgs, img)
+	}
+	encode := func(optimize bool) []byte {
+		var b bytes.Buffer
+		if err := gif.EncodeAll(&b, buildGIF(imgs, &gifOptions{delay: 10, palette: palette.Plan9, optimize: optimize})); err != nil {
+			t.Fatal(err)
+		}
+		return b.Bytes()
+	}
+	full, optimized := encode(false), encode(true)
+	if len(optimized) >= len(full) {
+		t.Errorf("the optimized GIF is %d bytes, the full one is %d bytes", len(optimized), len(full))
+	}
+	want, got := decodeFrames(t, full), decodeFrames(t, optimized)
+	if len(got) != len(want) {
+		t.Fatalf("got %d frames, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(got[i].Pix, want[i].Pix) {
+			t.Errorf("frame %d differs", i)
+		}
+	}
+}
+
+// decodeFrames returns the frames of the GIF as displayed, drawing each one over the previous ones since they
+// use DisposalNone.
+func decodeFrames(t *testing.T, b []byte) []*image.RGBA {
+	g, err := gif.DecodeAll(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	canvas := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	out := make([]*image.RGBA, len(g.Image))
+	for i, frame := range g.Image {
+		if g.Disposal[i] != gif.DisposalNone {
+			t.Fatalf("frame %d: unexpected disposal %d", i, g.Disposal[i])
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Src)
+		out[i] = image.NewRGBA(canvas.Bounds())
+		copy(out[i].Pix, canvas.Pix)
+	}
+	return out
+}
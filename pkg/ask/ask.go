@@ -0,0 +1,484 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package ask sends a prompt to a provider, running the tool calls of the model.
+//
+// It is the logic behind the ask command, for Go programs that want to embed it instead of shelling out.
+//
+// Example:
+//
+//	res, err := ask.Run(ctx, ask.Options{
+//		ProviderName: "anthropic",
+//		Prompt:       "Read README.md then summarize it in two sentences",
+//		Shell:        true,
+//		OnFragment: func(f genai.Reply) {
+//			fmt.Print(f.Text)
+//		},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	fmt.Printf("\n%d output tokens\n", res.Usage.OutputTokens)
+package ask
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/maruel/genai"
+	"github.com/maruel/genai/adapters"
+	"github.com/maruel/genai/base"
+	"github.com/maruel/genaitools/shelltool"
+)
+
+// Options is the request to send, mirroring the flags of the ask command.
+type Options struct {
+	// Provider is the provider to use. When nil, it is loaded with LoadProvider using ProviderName, Model and
+	// Remote.
+	Provider     genai.Provider
+	ProviderName string
+	Model        string
+	Remote       string
+
+	// Messages are the previous turns of the conversation, sent before the request.
+	Messages genai.Messages
+	// Prompt is the text of the request.
+	Prompt string
+	// Files are the paths or URLs of the documents to send along the prompt.
+	//
+	// A local path can be suffixed with "#caption" to describe the document to the model, e.g.
+	// "q3.pdf#Sales report for Q3".
+	//
+	// "git:diff", "git:staged" and "git:<revision>", e.g. "git:HEAD~1", attach the output of git diff in the
+	// current directory as a text document. "git:tree" attaches the list of the files tracked by git.
+	//
+	// A directory or a glob pattern, e.g. "src/**/*.go", is replaced by the files it contains, except the ones
+	// matching Ignore and the ones larger than MaxFileSize, DefaultMaxFileSize when 0.
+	Files []string
+	// Ignore are glob patterns matched against the path and the name of the files found in the directories
+	// and the glob patterns of Files, e.g. "*_test.go" or "vendor".
+	Ignore      []string
+	MaxFileSize int64
+	// Tabular sends the local .csv, .tsv and .xlsx files as text in markdown tables, for the models that don't
+	// support spreadsheets. Sheet selects the sheet of the xlsx files; the first one is used when empty.
+	// TabularMaxRows is the number of rows kept, DefaultTabularMaxRows when 0.
+	Tabular        bool
+	Sheet          string
+	TabularMaxRows int
+	// Fence sends the local source code files and the git diffs as text in markdown code blocks tagged with
+	// their language, detected from the file extension, instead of as documents.
+	Fence bool
+	// Stdin is read and sent as a text document named stdin.txt, when set.
+	Stdin io.Reader
+	// Redact are the patterns replaced with RedactPlaceholder in the text documents, e.g. RedactPatterns. The
+	// documents fetched by URL and the prompt are not redacted.
+	Redact       []*regexp.Regexp
+	SystemPrompt string
+	// Temperature, TopP and MaxTokens are the text generation parameters; 0 uses the provider's default.
+	Temperature float64
+	TopP        float64
+	MaxTokens   int64
+	// Seed makes the generation deterministic with the providers supporting it; 0 is random.
+	Seed int64
+	// MaxCost is the budget in US dollars. Run fails with ErrBudgetExceeded without sending the request when
+	// the prompt is estimated to cost more, and stops the tool call loop once the budget is spent. The price of
+	// the model must be in Prices. 0 means unlimited.
+	MaxCost float64
+	// IgnoreContextWindow sends the request even when the prompt is estimated to exceed the context window of
+	// the model. Otherwise ChunkStrategy is applied, which defaults to ChunkRefuse failing with
+	// ErrContextWindowExceeded without sending it.
+	IgnoreContextWindow bool
+	ChunkStrategy       ChunkStrategy
+	// Image is set to request a specific image size.
+	Image *genai.GenOptionImage
+
+	// Shell enables the sandboxed shell tool. Run fails if no sandbox is available.
+	//
+	// The tool writes the scripts to run in os.TempDir(); see UsePrivateTempDir.
+	Shell bool
+	// Web enables the web search of the provider.
+	Web bool
+	// WebFetch enables the sandboxed shell tool with network access, letting the model search and fetch web
+	// pages with curl when the provider has no web search. Run fails if no sandbox is available.
+	WebFetch bool
+	// OutDir enables the write_file tool, letting the model create files in this directory.
+	OutDir string
+	// Force lets the write_file tool overwrite existing files.
+	Force bool
+	// CustomTools are run in the sandboxed shell. Run fails if no sandbox is available.
+	CustomTools []CustomTool
+	// Tools are additional tools implemented by the caller.
+	Tools []genai.ToolDef
+	// MaxTurns is the maximum number of requests sent in the tool call loop; 0 means unlimited. The loop is
+	// also aborted when the model requests the same tool calls three times in a row.
+	MaxTurns int
+	// AbortOnToolError makes a command run by a tool exiting with an error abort the request with a *ToolError,
+	// instead of returning the error to the model.
+	AbortOnToolError bool
+	// RetryModality is set to retry once when the model replies without the requested output modality.
+	RetryModality bool
+	// RetryRefusal is set to retry once with a neutral system prompt suffix when the model refuses to reply.
+	RetryRefusal bool
+
+	// The hooks below let the caller render the reply its own way. They are called synchronously from the
+	// goroutine calling Run and are not called anymore once the context is canceled.
+
+	// OnFragment is called for each fragment streamed by the model.
+	OnFragment func(f genai.Reply)
+	// OnToolCall is called before each tool call with the arguments as JSON.
+	OnToolCall func(name, args string)
+	// OnToolResult is called after each tool call.
+	OnToolResult func(name, out string, err error)
+}
+
+// Result is the reply of the model.
+type Result struct {
+	genai.Result
+	// Messages is the conversation: Options.Messages, the request, the tool calls and their results, and the
+	// reply. It can be sent as Options.Messages to continue the conversation.
+	Messages genai.Messages
+	// Missing are the requested output modalities that were not produced by the model.
+	Missing []genai.Modality
+	// Warnings are about the inputs, e.g. a spreadsheet truncated.
+	Warnings []string
+}
+
+// Run sends the request and returns the last reply of the model.
+//
+// The documents in the reply must be retrieved promptly, since the URLs returned by some providers expire
+// quickly. On error, the partial result is still returned, so the documents generated so far can be saved.
+func Run(ctx context.Context, o Options) (Result, error) {
+	c := o.Provider
+	if c == nil {
+		var opts []genai.ProviderOption
+		if o.Model != "" {
+			opts = append(opts, genai.ProviderOptionModel(o.Model))
+		}
+		if o.Remote != "" {
+			opts = append(opts, genai.ProviderOptionRemote(o.Remote))
+		}
+		var err error
+		if c, err = LoadProvider(ctx, o.ProviderName, opts...); err != nil {
+			return Result{}, err
+		}
+	}
+
+	// Process inputs
+	userMsg := genai.Message{}
+	if o.Prompt != "" {
+		userMsg.Requests = append(userMsg.Requests, genai.Request{Text: o.Prompt})
+	}
+	maxFileSize := o.MaxFileSize
+	if maxFileSize == 0 {
+		maxFileSize = DefaultMaxFileSize
+	}
+	files, warnings, err := ExpandFiles(o.Files, o.Ignore, maxFileSize)
+	if err != nil {
+		return Result{}, err
+	}
+	var closers []io.Closer
+	defer func() {
+		for _, c := range closers {
+			_ = c.Close()
+		}
+	}()
+	for _, n := range files {
+		if isURL(n) {
+			userMsg.Requests = append(userMsg.Requests, genai.Request{Doc: genai.Doc{URL: n}})
+			continue
+		}
+		n, caption := splitCaption(n)
+		var doc genai.Doc
+		lang := ""
+		asText := false
+		if spec, ok := strings.CutPrefix(n, "git:"); ok {
+			b, err := gitSource(ctx, spec)
+			if err != nil {
+				return Result{}, err
+			}
+			doc = genai.Doc{Filename: "git-" + strings.NewReplacer("/", "_", ":", "_").Replace(spec) + ".txt", Src: bytes.NewReader(b)}
+			lang = "diff"
+			if spec == "tree" {
+				lang = "text"
+			}
+		} else if o.Tabular && isTabular(n) {
+			maxRows := o.TabularMaxRows
+			if maxRows == 0 {
+				maxRows = DefaultTabularMaxRows
+			}
+			t, dropped, err := readTabular(n, o.Sheet, maxRows)
+			if err != nil {
+				return Result{}, err
+			}
+			if dropped != 0 {
+				warnings = append(warnings, fmt.Sprintf("%s: sent the first %d rows, %d more rows were truncated", n, maxRows, dropped))
+			}
+			doc = genai.Doc{Filename: filepath.Base(n), Src: strings.NewReader(t)}
+			asText = true
+		} else {
+			// Read the file in memory so the documents in Result.Messages stay readable once Run returns.
+			b, err := os.ReadFile(n)
+			if err != nil {
+				return Result{}, err
+			}
+			doc = genai.Doc{Filename: filepath.Base(n), Src: bytes.NewReader(b)}
+			lang = fenceLanguage(n)
+		}
+		if len(o.Redact) != 0 {
+			var err error
+			if doc, err = redactDoc(ctx, doc, o.Redact); err != nil {
+				return Result{}, err
+			}
+		}
+		if caption != "" {
+			userMsg.Requests = append(userMsg.Requests, genai.Request{Text: fmt.Sprintf("The next document is %s: %s", filepath.Base(n), caption)})
+		}
+		req := genai.Request{Doc: doc}
+		if asText {
+			b, err := io.ReadAll(doc.Src)
+			if err != nil {
+				return Result{}, err
+			}
+			req = genai.Request{Text: string(b)}
+		} else if o.Fence && lang != "" {
+			var err error
+			if req, err = fenceDoc(doc, lang); err != nil {
+				return Result{}, err
+			}
+		}
+		userMsg.Requests = append(userMsg.Requests, req)
+	}
+	if o.Stdin != nil {
+		// Buffer stdin so the request can be sent multiple times, e.g. with RetryModality or when falling back
+		// to another provider.
+		b, err := io.ReadAll(o.Stdin)
+		if err != nil {
+			return Result{}, err
+		}
+		doc := genai.Doc{Filename: "stdin.txt", Src: bytes.NewReader(b)}
+		if len(o.Redact) != 0 {
+			if doc, err = redactDoc(ctx, doc, o.Redact); err != nil {
+				return Result{}, err
+			}
+		}
+		userMsg.Requests = append(userMsg.Requests, genai.Request{Doc: doc})
+	}
+	if len(userMsg.Requests) == 0 {
+		return Result{}, errors.New("provide a prompt or input files")
+	}
+	msgs := append(slices.Clip(o.Messages), userMsg)
+	var opts []genai.GenOption
+	if o.SystemPrompt != "" || o.Temperature != 0 || o.TopP != 0 || o.MaxTokens != 0 {
+		opts = append(opts, &genai.GenOptionText{
+			SystemPrompt: o.SystemPrompt,
+			Temperature:  o.Temperature,
+			TopP:         o.TopP,
+			MaxTokens:    o.MaxTokens,
+		})
+	}
+	if o.Seed != 0 {
+		opts = append(opts, genai.GenOptionSeed(o.Seed))
+	}
+	if o.Image != nil {
+		opts = append(opts, o.Image)
+	}
+
+	// All the tools must be in a single GenOptionTools.
+	var tools []genai.ToolDef
+	if o.Shell || o.WebFetch || len(o.CustomTools) != 0 {
+		s, err := shelltool.New(false)
+		if s == nil {
+			return Result{}, fmt.Errorf("could not find sandbox: %w", err)
+		}
+		if o.WebFetch {
+			// The custom tools stay without network access.
+			n, err := shelltool.New(true)
+			if n == nil {
+				return Result{}, fmt.Errorf("could not find sandbox: %w", err)
+			}
+			tools = append(tools, n.Tools...)
+		} else if o.Shell {
+			tools = append(tools, s.Tools...)
+		}
+		for i := range o.CustomTools {
+			tools = append(tools, o.CustomTools[i].toolDef(&s.Tools[0]))
+		}
+	}
+	if o.OutDir != "" {
+		t, root, err := newWriteFileTool(o.OutDir, o.Force)
+		if err != nil {
+			return Result{}, err
+		}
+		closers = append(closers, root)
+		tools = append(tools, t)
+	}
+	tools = append(tools, o.Tools...)
+	if len(tools) != 0 {
+		tools = wrapTools(tools, o.AbortOnToolError, o.OnToolCall, o.OnToolResult)
+		opts = append(opts, &genai.GenOptionTools{Tools: tools})
+	}
+	if o.Web {
+		opts = append(opts, &genai.GenOptionWeb{Search: true})
+	}
+	// chunkUsage is the usage of the summaries of the files with ChunkMapReduce.
+	var chunkUsage genai.Usage
+	if !o.IgnoreContextWindow {
+		// The prompt is never cut.
+		first := 0
+		if o.Prompt != "" {
+			first = 1
+		}
+		var err error
+		if chunkUsage, err = fitContextWindow(ctx, c, msgs, first, &o); err != nil {
+			return Result{Warnings: warnings}, err
+		}
+	}
+	if o.MaxCost > 0 {
+		var err error
+		if c, err = checkBudget(c, msgs, o.SystemPrompt, o.MaxCost); err != nil {
+			return Result{Warnings: warnings}, err
+		}
+	}
+	res, err := run(ctx, c, msgs, opts, o.OnFragment, len(tools) != 0, o.MaxTurns)
+	if err == nil && len(res.Missing) != 0 && o.RetryModality {
+		retry := slices.Clone(msgs)
+		retry[len(retry)-1].Requests = append(slices.Clone(retry[len(retry)-1].Requests), genai.Request{
+			Text: fmt.Sprintf("Reply with the %s itself, not with text.", ModalitiesNames(res.Missing)),
+		})
+		prev := res.Usage
+		res, err = run(ctx, c, retry, opts, o.OnFragment, len(tools) != 0, o.MaxTurns)
+		// The first attempt is billed too.
+		res.Usage.Add(&prev)
+	}
+	if err == nil && o.RetryRefusal && isRefusal(&res) {
+		slog.WarnContext(ctx, "refusal", "msg", "retrying once with a neutral system prompt", "finish", res.Usage.FinishReason)
+		sp := strings.TrimSpace(o.SystemPrompt + "\n\n" + refusalRetryPrompt)
+		prev := res.Usage
+		res, err = run(ctx, c, msgs, withSystemPrompt(opts, sp), o.OnFragment, len(tools) != 0, o.MaxTurns)
+		res.Usage.Add(&prev)
+	}
+	res.Usage.Add(&chunkUsage)
+	res.Warnings = warnings
+	return res, err
+}
+
+// run sends the request once, streaming the fragments to onFragment. With tools, the tool call loop is
+// limited to maxTurns requests.
+func run(ctx context.Context, c genai.Provider, msgs genai.Messages, opts []genai.GenOption, onFragment func(genai.Reply), hasTools bool, maxTurns int) (Result, error) {
+	var fragments iter.Seq[genai.Reply]
+	var finishTools func() (genai.Messages, genai.Usage, error)
+	var finishStream func() (genai.Result, error)
+	if hasTools {
+		fragments, finishTools = adapters.GenStreamWithToolCallLoop(ctx, &providerTurns{Provider: c, max: maxTurns}, msgs, opts...)
+	} else {
+		fragments, finishStream = c.GenStream(ctx, msgs, opts...)
+	}
+	for f := range fragments {
+		if ctx.Err() != nil {
+			// Stop consuming the stream, which aborts the request.
+			break
+		}
+		if onFragment != nil {
+			onFragment(f)
+		}
+	}
+	var res Result
+	var err error
+	if finishTools != nil {
+		var replies genai.Messages
+		replies, res.Usage, err = finishTools()
+		if len(replies) != 0 {
+			res.Message = replies[len(replies)-1]
+		}
+		// finishTools only returns the new messages.
+		res.Messages = append(slices.Clip(msgs), replies...)
+	} else {
+		res.Result, err = finishStream()
+		res.Messages = append(slices.Clip(msgs), res.Message)
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	slog.Info("done", "usage", res.Usage.String(), "finish", res.Usage.FinishReason)
+	if err != nil {
+		return res, err
+	}
+	res.Missing = missingModalities(c.OutputModalities(), &res.Message)
+	return res, nil
+}
+
+// missingModalities returns the non-text modalities in want that are not present in the replies.
+//
+// Models that can reply with text are not checked, since a text only reply is legitimate for them.
+func missingModalities(want genai.Modalities, msg *genai.Message) []genai.Modality {
+	if len(want) == 0 || slices.Contains(want, genai.ModalityText) {
+		return nil
+	}
+	var missing []genai.Modality
+	for _, m := range want {
+		found := false
+		for i := range msg.Replies {
+			if d := &msg.Replies[i].Doc; !d.IsZero() {
+				if strings.HasPrefix(base.MimeByExt(filepath.Ext(d.GetFilename())), string(m)+"/") {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			missing = append(missing, m)
+		}
+	}
+	return missing
+}
+
+// ModalitiesNames returns a human readable list of modalities.
+func ModalitiesNames(m []genai.Modality) string {
+	s := make([]string, len(m))
+	for i := range m {
+		s[i] = string(m[i])
+	}
+	return strings.Join(s, " or ")
+}
+
+// splitCaption splits "path#caption". A file whose name contains a '#' is used as is.
+func splitCaption(n string) (string, string) {
+	i := strings.LastIndexByte(n, '#')
+	if i < 0 {
+		return n, ""
+	}
+	if _, err := os.Stat(n); err == nil {
+		return n, ""
+	}
+	return n[:i], strings.TrimSpace(n[i+1:])
+}
+
+// ReadSource returns the content of a file returned by ExpandFiles, or the output of git for the git:
+// pseudo-sources. The caption appended with '#' is ignored. URLs are not supported since the provider fetches
+// them.
+func ReadSource(ctx context.Context, n string) ([]byte, error) {
+	if isURL(n) {
+		return nil, fmt.Errorf("%s: URLs are not supported", n)
+	}
+	if spec, ok := strings.CutPrefix(n, "git:"); ok {
+		return gitSource(ctx, spec)
+	}
+	n, _ = splitCaption(n)
+	return os.ReadFile(n)
+}
+
+// isURL returns true when the file is to be fetched by the provider instead of read locally.
+func isURL(n string) bool {
+	return strings.HasPrefix(n, "http://") || strings.HasPrefix(n, "https://")
+}
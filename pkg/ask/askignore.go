@@ -0,0 +1,135 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Support of the .askignore files, in the gitignore syntax, when a directory is in Options.Files.
+
+package ask
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/maruel/genai/base"
+)
+
+// askIgnoreFile is the name of the files listing the files to skip in the directories in Options.Files.
+const askIgnoreFile = ".askignore"
+
+// defaultIgnore are the rules applied before the .askignore files, which can negate them.
+const defaultIgnore = `
+node_modules/
+__pycache__/
+bower_components/
+*.pyc
+*.class
+*.o
+*.obj
+*.a
+*.so
+*.dylib
+*.dll
+*.exe
+`
+
+// ignoreRule is a line of a .askignore file.
+type ignoreRule struct {
+	// dir is the slash separated directory of the .askignore file, relative to the directory walked.
+	dir      string
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// parseIgnore parses the content of a .askignore file in the directory dir.
+func parseIgnore(dir, content string) []ignoreRule {
+	var rules []ignoreRule
+	for l := range strings.Lines(content) {
+		l = strings.TrimRight(l, " \t\r\n")
+		if l == "" || l[0] == '#' {
+			continue
+		}
+		r := ignoreRule{dir: dir}
+		if l[0] == '!' {
+			r.negate = true
+			l = l[1:]
+		} else if l[0] == '\\' {
+			l = l[1:]
+		}
+		if s, ok := strings.CutSuffix(l, "/"); ok {
+			r.dirOnly = true
+			l = s
+		}
+		// A pattern with a slash other than at the end is relative to the directory of the file.
+		if strings.Contains(l, "/") {
+			r.anchored = true
+			l = strings.TrimPrefix(l, "/")
+		}
+		if l == "" {
+			continue
+		}
+		r.pattern = l
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// isIgnoredBy returns true when the slash separated path p, relative to the directory walked, is ignored by
+// the rules. Like git, the last rule matching wins.
+func isIgnoredBy(rules []ignoreRule, p string, isDir bool) bool {
+	ignored := false
+	for i := range rules {
+		r := &rules[i]
+		if r.dirOnly && !isDir {
+			continue
+		}
+		rel := p
+		if r.dir != "" {
+			var ok bool
+			if rel, ok = strings.CutPrefix(p, r.dir+"/"); !ok {
+				continue
+			}
+		}
+		pattern := r.pattern
+		if !r.anchored {
+			pattern = "**/" + pattern
+		}
+		if matchGlob(pattern, rel) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// loadIgnore returns the rules of the .askignore file in the directory d, named dir relative to the directory
+// walked.
+func loadIgnore(d, dir string) ([]ignoreRule, error) {
+	b, err := os.ReadFile(filepath.Join(d, askIgnoreFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseIgnore(dir, string(b)), nil
+}
+
+// isBinary returns true when the file contains a NUL byte in its first block and its type is not known to
+// the providers, e.g. an executable.
+func isBinary(p string) bool {
+	if base.MimeByExt(filepath.Ext(p)) != "" {
+		return false
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	var buf [8192]byte
+	n, _ := io.ReadFull(f, buf[:])
+	return bytes.IndexByte(buf[:n], 0) >= 0
+}
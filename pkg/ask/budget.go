@@ -0,0 +1,116 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Enforcement of Options.MaxCost.
+
+package ask
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"path/filepath"
+	"strings"
+
+	"github.com/maruel/genai"
+	"github.com/maruel/genai/base"
+)
+
+// ErrBudgetExceeded is returned when a request would cost more than Options.MaxCost.
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// checkBudget estimates the cost of the input of the request and returns the provider wrapped to stop the
+// tool call loop once the budget is spent.
+func checkBudget(c genai.Provider, msgs genai.Messages, systemPrompt string, maxCost float64) (genai.Provider, error) {
+	p, ok := LookupPrice(c.ModelID())
+	if !ok {
+		return nil, fmt.Errorf("unknown price for model %s, the budget of $%.4f cannot be enforced", c.ModelID(), maxCost)
+	}
+	if est := float64(estimateTokens(msgs, systemPrompt)) * p.Input / 1e6; est > maxCost {
+		return nil, fmt.Errorf("%w: the prompt is estimated at $%.4f, more than $%.4f", ErrBudgetExceeded, est, maxCost)
+	}
+	return &providerBudget{Provider: c, max: maxCost}, nil
+}
+
+// estimateTokens returns a rough estimate of the number of input tokens of the request, at 4 bytes per token.
+//
+// Only the text and the text documents are counted, since the number of tokens of an image or a PDF depends on
+// the provider.
+func estimateTokens(msgs genai.Messages, systemPrompt string) int64 {
+	n := int64(len(systemPrompt))
+	for i := range msgs {
+		for j := range msgs[i].Requests {
+			r := &msgs[i].Requests[j]
+			n += int64(len(r.Text))
+			if !isTextDoc(&r.Doc) {
+				continue
+			}
+			if size, err := r.Doc.Src.Seek(0, io.SeekEnd); err == nil {
+				n += size
+			}
+			_, _ = r.Doc.Src.Seek(0, io.SeekStart)
+		}
+		for j := range msgs[i].Replies {
+			n += int64(len(msgs[i].Replies[j].Text))
+		}
+	}
+	return n / 4
+}
+
+// isTextDoc returns true when the document is a local text file.
+func isTextDoc(d *genai.Doc) bool {
+	return d.Src != nil && strings.HasPrefix(base.MimeByExt(filepath.Ext(d.GetFilename())), "text/")
+}
+
+// providerBudget wraps a Provider to fail the requests once the cost of the previous ones reaches max.
+//
+// The tool call loop sends one request per turn, so it is aborted at the turn following the one exceeding the
+// budget.
+type providerBudget struct {
+	genai.Provider
+	max   float64
+	spent float64
+}
+
+func (c *providerBudget) GenSync(ctx context.Context, msgs genai.Messages, opts ...genai.GenOption) (genai.Result, error) {
+	if err := c.check(); err != nil {
+		return genai.Result{}, err
+	}
+	res, err := c.Provider.GenSync(ctx, msgs, opts...)
+	c.add(&res.Usage)
+	return res, err
+}
+
+func (c *providerBudget) GenStream(ctx context.Context, msgs genai.Messages, opts ...genai.GenOption) (iter.Seq[genai.Reply], func() (genai.Result, error)) {
+	if err := c.check(); err != nil {
+		return func(yield func(genai.Reply) bool) {}, func() (genai.Result, error) {
+			return genai.Result{}, err
+		}
+	}
+	fragments, finish := c.Provider.GenStream(ctx, msgs, opts...)
+	return fragments, func() (genai.Result, error) {
+		res, err := finish()
+		c.add(&res.Usage)
+		return res, err
+	}
+}
+
+func (c *providerBudget) Unwrap() genai.Provider {
+	return c.Provider
+}
+
+func (c *providerBudget) check() error {
+	if c.spent >= c.max {
+		return fmt.Errorf("%w: spent $%.4f of $%.4f", ErrBudgetExceeded, c.spent, c.max)
+	}
+	return nil
+}
+
+func (c *providerBudget) add(u *genai.Usage) {
+	if usd, ok := Cost(c.ModelID(), u); ok {
+		c.spent += usd
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Truncation and summarization of the text files for Options.ChunkStrategy.
+
+package ask
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/maruel/genai"
+)
+
+const summarizePrompt = `This is part %d of %d of %s. Summarize it concisely, keeping the facts, names, numbers
+and code needed to answer this request: %s
+
+%s`
+
+// fileText is the content of a text file of the request.
+type fileText struct {
+	i    int
+	name string
+	text string
+}
+
+// fileTexts returns the text files of the requests, largest first.
+func fileTexts(reqs []genai.Request) ([]fileText, error) {
+	var out []fileText
+	for i := range reqs {
+		r := &reqs[i]
+		switch {
+		case r.Text != "":
+			out = append(out, fileText{i: i, name: "the document", text: r.Text})
+		case isTextDoc(&r.Doc):
+			b, err := io.ReadAll(r.Doc.Src)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := r.Doc.Src.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+			out = append(out, fileText{i: i, name: r.Doc.GetFilename(), text: string(b)})
+		}
+	}
+	slices.SortStableFunc(out, func(a, b fileText) int {
+		return cmp.Compare(len(b.text), len(a.text))
+	})
+	return out, nil
+}
+
+// truncateFiles cuts excess bytes from the end of the largest text files.
+func truncateFiles(reqs []genai.Request, excess int64) error {
+	files, err := fileTexts(reqs)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if excess <= 0 {
+			break
+		}
+		kept := cutUTF8(f.text, max(int64(len(f.text))-excess, 0))
+		excess -= int64(len(f.text) - len(kept))
+		slog.Info("chunk", "msg", "truncated", "file", f.name, "kept", len(kept), "size", len(f.text))
+		reqs[f.i] = genai.Request{Text: fmt.Sprintf("%s\n\n[%s was truncated: the first %d bytes of %d were kept]", kept, f.name, len(kept), len(f.text))}
+	}
+	return nil
+}
+
+// summarizeFiles replaces the largest text files by their summary until excess bytes are saved. Each file is
+// split in chunks of chunkSize bytes summarized separately with the prompt in mind.
+func summarizeFiles(ctx context.Context, c genai.Provider, reqs []genai.Request, prompt string, excess, chunkSize int64) (genai.Usage, error) {
+	var u genai.Usage
+	files, err := fileTexts(reqs)
+	if err != nil {
+		return u, err
+	}
+	if prompt == "" {
+		prompt = "(none, keep the important details)"
+	}
+	for _, f := range files {
+		if excess <= 0 {
+			break
+		}
+		chunks := splitChunks(f.text, int(chunkSize))
+		parts := make([]string, 0, len(chunks))
+		for j, chunk := range chunks {
+			slog.Info("chunk", "msg", "summarizing", "file", f.name, "part", j+1, "parts", len(chunks))
+			msg := genai.NewTextMessage(fmt.Sprintf(summarizePrompt, j+1, len(chunks), f.name, prompt, chunk))
+			res, err := c.GenSync(ctx, genai.Messages{msg})
+			u.Add(&res.Usage)
+			if err != nil {
+				return u, fmt.Errorf("summarizing part %d of %d of %s: %w", j+1, len(chunks), f.name, err)
+			}
+			parts = append(parts, strings.TrimSpace(res.String()))
+		}
+		s := fmt.Sprintf("Summary of %s, which was too large to be sent, made from %d parts:\n\n%s", f.name, len(chunks), strings.Join(parts, "\n\n"))
+		excess -= int64(len(f.text) - len(s))
+		reqs[f.i] = genai.Request{Text: s}
+	}
+	return u, nil
+}
+
+// splitChunks splits s in chunks of at most size bytes, at a line boundary when possible.
+func splitChunks(s string, size int) []string {
+	var out []string
+	for len(s) > size {
+		i := strings.LastIndexByte(s[:size], '\n') + 1
+		if i == 0 {
+			i = len(cutUTF8(s, int64(size)))
+		}
+		out = append(out, s[:i])
+		s = s[i:]
+	}
+	if s != "" {
+		out = append(out, s)
+	}
+	return out
+}
+
+// cutUTF8 returns the first n bytes of s, or less to not cut a rune.
+func cutUTF8(s string, n int64) string {
+	if n >= int64(len(s)) {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,109 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Pre-flight check of the size of the prompt against the context window of the model.
+
+package ask
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/maruel/genai"
+)
+
+// ErrContextWindowExceeded is returned when the prompt is estimated to not fit in the context window of the
+// model.
+var ErrContextWindowExceeded = errors.New("context window exceeded")
+
+// ContextWindows are the number of input tokens of the popular models, keyed by the prefix of their model ID.
+var ContextWindows = map[string]int64{
+	"claude-opus-4":     200_000,
+	"claude-sonnet-4":   200_000,
+	"claude-3-7-sonnet": 200_000,
+	"claude-haiku-4-5":  200_000,
+	"claude-3-5-haiku":  200_000,
+	"gpt-5":             272_000,
+	"gpt-4.1":           1_047_576,
+	"gpt-4o":            128_000,
+	"o3":                200_000,
+	"o4-mini":           200_000,
+	"gemini-2.5":        1_048_576,
+	"gemini-2.0-flash":  1_048_576,
+	"deepseek-chat":     128_000,
+	"deepseek-reasoner": 128_000,
+	"mistral-large":     131_072,
+	"mistral-medium":    131_072,
+	"mistral-small":     131_072,
+	"grok-4":            256_000,
+	"grok-3":            131_072,
+}
+
+// ChunkStrategy is how Run handles a request estimated to exceed the context window of the model.
+type ChunkStrategy string
+
+const (
+	// ChunkRefuse fails with ErrContextWindowExceeded without sending the request.
+	ChunkRefuse ChunkStrategy = "refuse"
+	// ChunkTruncate cuts the end of the largest text files until the request fits.
+	ChunkTruncate ChunkStrategy = "truncate"
+	// ChunkMapReduce splits the largest text files in chunks, asks the model to summarize each chunk with the
+	// prompt in mind, then sends the summaries in place of the files.
+	ChunkMapReduce ChunkStrategy = "map-reduce"
+)
+
+// fitContextWindow applies the strategy when the request is estimated to exceed the context window of the
+// model. Models not in ContextWindows are not checked.
+//
+// The last message is the user's request and first is the index of its first file. The files are replaced in
+// place. It returns the usage of the summaries.
+func fitContextWindow(ctx context.Context, c genai.Provider, msgs genai.Messages, first int, o *Options) (genai.Usage, error) {
+	var u genai.Usage
+	window, ok := lookupModel(ContextWindows, c.ModelID())
+	if !ok {
+		return u, nil
+	}
+	est := estimateTokens(msgs, o.SystemPrompt)
+	if est <= window {
+		return u, nil
+	}
+	// Leave room for the reply.
+	target := window * 8 / 10
+	reqs := msgs[len(msgs)-1].Requests[first:]
+	var err error
+	switch o.ChunkStrategy {
+	case "", ChunkRefuse:
+	case ChunkTruncate:
+		err = truncateFiles(reqs, 4*(est-target))
+	case ChunkMapReduce:
+		u, err = summarizeFiles(ctx, c, reqs, o.Prompt, 4*(est-target), 4*target/2)
+	default:
+		return u, fmt.Errorf("unknown chunk strategy %q", o.ChunkStrategy)
+	}
+	if err != nil {
+		return u, err
+	}
+	if est = estimateTokens(msgs, o.SystemPrompt); est > window {
+		return u, fmt.Errorf("%w: the prompt and the files are estimated at %d tokens, more than the %d tokens of %s", ErrContextWindowExceeded, est, window, c.ModelID())
+	}
+	return u, nil
+}
+
+// lookupModel returns the value of the longest key of m prefixing the model ID, ignoring the organization
+// prefix of routers.
+func lookupModel[T any](m map[string]T, model string) (T, bool) {
+	if i := strings.LastIndexByte(model, '/'); i >= 0 {
+		model = model[i+1:]
+	}
+	best := ""
+	for k := range m {
+		if strings.HasPrefix(model, k) && len(k) > len(best) {
+			best = k
+		}
+	}
+	v, ok := m[best]
+	return v, ok && best != ""
+}
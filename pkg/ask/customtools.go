@@ -0,0 +1,292 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Tools declared in a YAML file, running a command in the sandboxed shell.
+
+package ask
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/invopop/jsonschema"
+	"github.com/maruel/genai"
+	"gopkg.in/yaml.v3"
+)
+
+// customToolSpec is a tool as declared in the file loaded by LoadCustomTools.
+//
+// Example:
+//
+//	# tools.yaml
+//	- name: word_count
+//	  description: Counts the words in a file.
+//	  parameters:
+//	    type: object
+//	    properties:
+//	      path:
+//	        type: string
+//	        description: Path of the file.
+//	    required: [path]
+//	  command: ["wc", "-w", "{{.path}}"]
+//	  dir: docs
+//	  timeout: 30s
+//
+// Each element of command is a text/template that is expanded with the arguments; missing optional arguments
+// are empty strings and elements expanding to an empty string are omitted. The elements are quoted before
+// being passed to the shell, so an argument cannot inject commands.
+//
+// dir is the directory the command runs in, relative to the current directory, which is mounted in the
+// sandbox. timeout is the maximum duration of the command; when reached, the command is killed and the model
+// is told.
+type customToolSpec struct {
+	Name        string         `yaml:"name"`
+	Description string         `yaml:"description"`
+	Parameters  map[string]any `yaml:"parameters"`
+	Command     []string       `yaml:"command"`
+	Dir         string         `yaml:"dir"`
+	Timeout     string         `yaml:"timeout"`
+}
+
+// CustomTool is a tool declared in a YAML file, running a command in the sandboxed shell.
+//
+// It is only available when a sandbox is found.
+type CustomTool struct {
+	name        string
+	description string
+	schema      *jsonschema.Schema
+	command     []*template.Template
+	dir         string
+	timeout     time.Duration
+}
+
+// LoadCustomTools reads and validates the tools declared in a YAML file.
+func LoadCustomTools(path string) ([]CustomTool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var specs []customToolSpec
+	d := yaml.NewDecoder(bytes.NewReader(b))
+	d.KnownFields(true)
+	if err := d.Decode(&specs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("%s: no tools", path)
+	}
+	out := make([]CustomTool, 0, len(specs))
+	seen := map[string]bool{}
+	for i := range specs {
+		t, err := specs[i].validate()
+		if err != nil {
+			return nil, fmt.Errorf("%s: tool #%d %q: %w", path, i, specs[i].Name, err)
+		}
+		if seen[t.name] {
+			return nil, fmt.Errorf("%s: tool %q declared twice", path, t.name)
+		}
+		seen[t.name] = true
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+func (s *customToolSpec) validate() (CustomTool, error) {
+	t := CustomTool{name: s.Name, description: s.Description}
+	if s.Name == "bash" || s.Name == "zsh" || s.Name == "powershell" || s.Name == "write_file" {
+		return t, errors.New("name conflicts with a builtin tool")
+	}
+	if len(s.Command) == 0 {
+		return t, errors.New("command is required")
+	}
+	if s.Dir != "" {
+		if !filepath.IsLocal(s.Dir) {
+			return t, fmt.Errorf("dir %q must be a relative path within the current directory", s.Dir)
+		}
+		fi, err := os.Stat(s.Dir)
+		if err != nil {
+			return t, fmt.Errorf("dir: %w", err)
+		}
+		if !fi.IsDir() {
+			return t, fmt.Errorf("dir %q is not a directory", s.Dir)
+		}
+		t.dir = filepath.ToSlash(filepath.Clean(s.Dir))
+	}
+	if s.Timeout != "" {
+		var err error
+		if t.timeout, err = time.ParseDuration(s.Timeout); err != nil {
+			return t, fmt.Errorf("timeout: %w", err)
+		}
+		if t.timeout <= 0 {
+			return t, errors.New("timeout must be positive")
+		}
+	}
+	if s.Parameters == nil {
+		s.Parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+	}
+	b, err := json.Marshal(s.Parameters)
+	if err != nil {
+		return t, fmt.Errorf("parameters: %w", err)
+	}
+	t.schema = &jsonschema.Schema{}
+	if err := json.Unmarshal(b, t.schema); err != nil {
+		return t, fmt.Errorf("parameters: %w", err)
+	}
+	if t.schema.Type != "object" {
+		return t, errors.New("parameters: type must be \"object\"")
+	}
+	if t.schema.Properties == nil {
+		t.schema.Properties = jsonschema.NewProperties()
+	}
+	for _, r := range t.schema.Required {
+		if _, ok := t.schema.Properties.Get(r); !ok {
+			return t, fmt.Errorf("parameters: required %q is not a property", r)
+		}
+	}
+	// Ensure the tool definition is accepted before it is sent to the provider.
+	def := genai.ToolDef{Name: t.name, Description: t.description, Callback: func(context.Context, *customToolArgs) (string, error) { return "", nil }}
+	if err := def.Validate(); err != nil {
+		return t, err
+	}
+	// Expand the templates with every property set, so a reference to an undeclared parameter fails now
+	// instead of when the model calls the tool.
+	zero := t.fill(nil)
+	for i, c := range s.Command {
+		tmpl, err := template.New(fmt.Sprintf("command[%d]", i)).Option("missingkey=error").Parse(c)
+		if err != nil {
+			return t, err
+		}
+		if err := tmpl.Execute(&bytes.Buffer{}, zero); err != nil {
+			return t, err
+		}
+		t.command = append(t.command, tmpl)
+	}
+	return t, nil
+}
+
+// Name returns the name of the tool as seen by the model.
+func (t *CustomTool) Name() string {
+	return t.name
+}
+
+// fill returns args with the missing optional properties set to an empty string.
+func (t *CustomTool) fill(args map[string]any) map[string]any {
+	out := make(map[string]any, t.schema.Properties.Len())
+	for p := t.schema.Properties.Oldest(); p != nil; p = p.Next() {
+		out[p.Key] = ""
+	}
+	maps.Copy(out, args)
+	return out
+}
+
+// toolDef returns the tool running the command with shell, the sandboxed shell tool.
+func (t *CustomTool) toolDef(shell *genai.ToolDef) genai.ToolDef {
+	return genai.ToolDef{
+		Name:                t.name,
+		Description:         t.description,
+		InputSchemaOverride: t.schema,
+		Callback: func(ctx context.Context, args *customToolArgs) (string, error) {
+			// Invalid arguments are returned to the model so it can adjust.
+			for _, r := range t.schema.Required {
+				if _, ok := args.values[r]; !ok {
+					return fmt.Sprintf("refused: argument %q is required", r), nil
+				}
+			}
+			for k := range args.values {
+				if _, ok := t.schema.Properties.Get(k); !ok {
+					return fmt.Sprintf("refused: unknown argument %q", k), nil
+				}
+			}
+			values := t.fill(args.values)
+			argv := make([]string, 0, len(t.command))
+			for _, tmpl := range t.command {
+				var b strings.Builder
+				if err := tmpl.Execute(&b, values); err != nil {
+					return "refused: " + err.Error(), nil
+				}
+				if b.Len() != 0 {
+					argv = append(argv, b.String())
+				}
+			}
+			line := shellJoin(argv)
+			if t.dir != "" {
+				line = shellChdir(t.dir, line)
+			}
+			script, err := json.Marshal(map[string]string{"script": line})
+			if err != nil {
+				return "", err
+			}
+			call := genai.ToolCall{Name: shell.Name, Arguments: string(script)}
+			if t.timeout == 0 {
+				// A command failing is handled by wrapTools.
+				return call.Call(ctx, []genai.ToolDef{*shell})
+			}
+			tctx, cancel := context.WithTimeout(ctx, t.timeout)
+			defer cancel()
+			out, err := call.Call(tctx, []genai.ToolDef{*shell})
+			if ctx.Err() == nil && errors.Is(tctx.Err(), context.DeadlineExceeded) {
+				// Tell the model so it can try something faster.
+				return fmt.Sprintf("%serror: timed out after %s\n", out, t.timeout), nil
+			}
+			return out, err
+		},
+	}
+}
+
+// customToolArgs holds the arguments of a custom tool, which are only known at runtime.
+type customToolArgs struct {
+	values map[string]any
+}
+
+func (c *customToolArgs) UnmarshalJSON(b []byte) error {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	return d.Decode(&c.values)
+}
+
+func (c *customToolArgs) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.values)
+}
+
+// shellChdir returns the command line running line in dir.
+func shellChdir(dir, line string) string {
+	if runtime.GOOS == "windows" {
+		// Windows PowerShell doesn't support &&.
+		return "Set-Location -LiteralPath " + shellQuote(dir) + "; if ($?) { " + line + " }"
+	}
+	return "cd " + shellQuote(dir) + " && " + line
+}
+
+// shellJoin returns argv as a command line for the sandboxed shell.
+func shellJoin(argv []string) string {
+	out := make([]string, len(argv))
+	for i, a := range argv {
+		out[i] = shellQuote(a)
+	}
+	if runtime.GOOS == "windows" {
+		// PowerShell needs the call operator to run a quoted command.
+		return "& " + strings.Join(out, " ")
+	}
+	return strings.Join(out, " ")
+}
+
+// shellQuote returns a quoted as a literal argument for the sandboxed shell.
+func shellQuote(a string) string {
+	// Both POSIX shells and PowerShell treat single quoted strings literally. Only the way to escape a single
+	// quote differs.
+	if runtime.GOOS == "windows" {
+		return "'" + strings.ReplaceAll(a, "'", "''") + "'"
+	}
+	return "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+}
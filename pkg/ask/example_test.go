@@ -0,0 +1,55 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Examples of the package, compiled but not run since they call a provider.
+
+package ask_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/maruel/ask/pkg/ask"
+	"github.com/maruel/genai"
+)
+
+func ExampleRun() {
+	ctx := context.Background()
+	// The shell tool writes its scripts in the temporary directory.
+	tmp, err := ask.UsePrivateTempDir()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() { _ = tmp.Close() }()
+
+	// The provider is loaded once to be reused across the turns.
+	c, err := ask.LoadProvider(ctx, "anthropic")
+	if err != nil {
+		log.Fatal(err)
+	}
+	res, err := ask.Run(ctx, ask.Options{
+		Provider: c,
+		Prompt:   "Read README.md then summarize it in two sentences",
+		Shell:    true,
+		OnFragment: func(f genai.Reply) {
+			fmt.Print(f.Text)
+		},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("\n%d output tokens\n", res.Usage.OutputTokens)
+
+	// Continue the conversation.
+	res, err = ask.Run(ctx, ask.Options{
+		Provider: c,
+		Messages: res.Messages,
+		Prompt:   "Now in one sentence.",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(res.String())
+}
@@ -0,0 +1,102 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Fencing of the source code documents in markdown code blocks.
+
+package ask
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/maruel/genai"
+)
+
+// fenceLanguages maps the file extensions to the markdown code block language tags.
+var fenceLanguages = map[string]string{
+	".bash":  "bash",
+	".c":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".cs":    "csharp",
+	".css":   "css",
+	".dart":  "dart",
+	".diff":  "diff",
+	".ex":    "elixir",
+	".exs":   "elixir",
+	".go":    "go",
+	".h":     "c",
+	".hpp":   "cpp",
+	".hs":    "haskell",
+	".java":  "java",
+	".js":    "javascript",
+	".jsx":   "jsx",
+	".kt":    "kotlin",
+	".lua":   "lua",
+	".m":     "objectivec",
+	".mjs":   "javascript",
+	".patch": "diff",
+	".php":   "php",
+	".pl":    "perl",
+	".proto": "protobuf",
+	".ps1":   "powershell",
+	".py":    "python",
+	".r":     "r",
+	".rb":    "ruby",
+	".rs":    "rust",
+	".scala": "scala",
+	".sh":    "bash",
+	".sql":   "sql",
+	".swift": "swift",
+	".tf":    "hcl",
+	".toml":  "toml",
+	".ts":    "typescript",
+	".tsx":   "tsx",
+	".vue":   "vue",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".zig":   "zig",
+	".zsh":   "zsh",
+}
+
+// fenceDoc returns the document as a text request in a fenced code block tagged with its language.
+//
+// The document is returned as is when its extension is not a known language or its content is binary.
+func fenceDoc(d genai.Doc, lang string) (genai.Request, error) {
+	b, err := io.ReadAll(d.Src)
+	if err != nil {
+		return genai.Request{}, err
+	}
+	name := d.GetFilename()
+	if !utf8.Valid(b) || bytes.IndexByte(b, 0) >= 0 {
+		return genai.Request{Doc: genai.Doc{Filename: name, Src: bytes.NewReader(b)}}, nil
+	}
+	// The fence must be longer than any backtick run in the content.
+	fence := strings.Repeat("`", max(3, longestRun(b, '`')+1))
+	s := strings.TrimRight(string(b), "\n")
+	return genai.Request{Text: fmt.Sprintf("%s:\n%s%s\n%s\n%s", name, fence, lang, s, fence)}, nil
+}
+
+// fenceLanguage returns the language tag for the file name, or "" when unknown.
+func fenceLanguage(name string) string {
+	return fenceLanguages[strings.ToLower(filepath.Ext(name))]
+}
+
+// longestRun returns the length of the longest run of c in b.
+func longestRun(b []byte, c byte) int {
+	longest, cur := 0, 0
+	for _, x := range b {
+		if x == c {
+			cur++
+			longest = max(longest, cur)
+		} else {
+			cur = 0
+		}
+	}
+	return longest
+}
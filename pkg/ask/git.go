@@ -0,0 +1,63 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Git diffs and file trees attached as documents with the git: pseudo-sources.
+
+package ask
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// gitSource returns the output of git for a git: pseudo-source in the current directory.
+//
+// "diff" is the uncommitted changes, "staged" the changes in the index, "tree" the list of the files tracked
+// and anything else is passed as a revision or range to git diff, e.g. "HEAD~1" or "main..feature".
+func gitSource(ctx context.Context, spec string) ([]byte, error) {
+	var args []string
+	switch spec {
+	case "diff":
+		args = []string{"diff"}
+	case "staged":
+		args = []string{"diff", "--cached"}
+	case "tree":
+		args = []string{"ls-files"}
+	case "":
+		return nil, errors.New("specify git:diff, git:staged, git:tree or git:<revision>")
+	default:
+		if strings.HasPrefix(spec, "-") {
+			return nil, fmt.Errorf("invalid git revision %q", spec)
+		}
+		args = []string{"diff", spec, "--"}
+	}
+	if err := exec.CommandContext(ctx, "git", "rev-parse", "--git-dir").Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("git:%s: not in a git repository", spec)
+		}
+		return nil, fmt.Errorf("git:%s: %w", spec, err)
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if s := strings.TrimSpace(stderr.String()); s != "" {
+			return nil, fmt.Errorf("git:%s: %s", spec, s)
+		}
+		return nil, fmt.Errorf("git:%s: %w", spec, err)
+	}
+	if len(out) == 0 {
+		if spec == "tree" {
+			return nil, fmt.Errorf("git:%s: no files tracked", spec)
+		}
+		return nil, fmt.Errorf("git:%s: no changes", spec)
+	}
+	return out, nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Expansion of the directories and the glob patterns in Options.Files.
+
+package ask
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultMaxFileSize is the size above which the files found by expanding a directory or a glob pattern are
+// skipped.
+const DefaultMaxFileSize = 1 << 20
+
+// ExpandFiles replaces the directories and the glob patterns in files with the files they contain, skipping
+// the ones matching ignore and the ones larger than maxSize. The files named explicitly are kept as is.
+//
+// It returns the warnings about the files skipped.
+func ExpandFiles(files, ignore []string, maxSize int64) ([]string, []string, error) {
+	var out, warnings []string
+	for _, n := range files {
+		if isURL(n) || strings.HasPrefix(n, "git:") {
+			out = append(out, n)
+			continue
+		}
+		p, caption := splitCaption(n)
+		fi, err := os.Stat(p)
+		isGlob := err != nil && strings.ContainsAny(p, "*?[")
+		if !isGlob && (err != nil || !fi.IsDir()) {
+			out = append(out, n)
+			continue
+		}
+		matches, err := findFiles(p, isGlob, ignore)
+		if err != nil {
+			return nil, nil, err
+		}
+		found := 0
+		for _, m := range matches {
+			if isIgnored(m, ignore) {
+				continue
+			}
+			if fi, err := os.Stat(m); err != nil || !fi.Mode().IsRegular() {
+				continue
+			} else if fi.Size() > maxSize {
+				warnings = append(warnings, fmt.Sprintf("%s: skipped, %d bytes is larger than %d", m, fi.Size(), maxSize))
+				continue
+			}
+			found++
+			if caption != "" {
+				m += "#" + caption
+			}
+			out = append(out, m)
+		}
+		if found == 0 {
+			return nil, nil, fmt.Errorf("%s: no file found", n)
+		}
+	}
+	return out, warnings, nil
+}
+
+// findFiles returns the files in the directory d, or matching the glob pattern d. "**" matches any number of
+// directories. The hidden files and directories and the ones matching ignore are skipped.
+//
+// When d is a directory, the files ignored by defaultIgnore and the .askignore files and the binaries are
+// skipped too.
+func findFiles(d string, isGlob bool, ignore []string) ([]string, error) {
+	if isGlob && !strings.Contains(d, "**") {
+		return filepath.Glob(d)
+	}
+	pattern := filepath.ToSlash(filepath.Clean(d))
+	root := d
+	if isGlob {
+		// Walk from the deepest directory without a pattern.
+		var fixed []string
+		for _, s := range strings.Split(pattern, "/") {
+			if strings.ContainsAny(s, "*?[") {
+				break
+			}
+			fixed = append(fixed, s)
+		}
+		root = filepath.FromSlash(strings.Join(fixed, "/"))
+		if root == "" {
+			root = "."
+		}
+	}
+	var rules []ignoreRule
+	if !isGlob {
+		rules = parseIgnore("", defaultIgnore)
+	}
+	var out []string
+	err := filepath.WalkDir(root, func(p string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if e.IsDir() {
+			if p != root && (strings.HasPrefix(e.Name(), ".") || isIgnored(p, ignore) || isIgnoredBy(rules, rel, true)) {
+				return filepath.SkipDir
+			}
+			if !isGlob {
+				dir := rel
+				if p == root {
+					dir = ""
+				}
+				r, err := loadIgnore(p, dir)
+				if err != nil {
+					return err
+				}
+				rules = append(rules, r...)
+			}
+			return nil
+		}
+		if strings.HasPrefix(e.Name(), ".") {
+			return nil
+		}
+		if isGlob {
+			if matchGlob(pattern, filepath.ToSlash(p)) {
+				out = append(out, p)
+			}
+		} else if !isIgnoredBy(rules, rel, false) && !isBinary(p) {
+			out = append(out, p)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// isIgnored returns true when the path or the file name matches one of the patterns.
+func isIgnored(p string, ignore []string) bool {
+	p = filepath.ToSlash(filepath.Clean(p))
+	for _, ig := range ignore {
+		if matchGlob(filepath.ToSlash(filepath.Clean(ig)), p) {
+			return true
+		}
+		if ok, _ := path.Match(ig, path.Base(p)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob returns true when the slash separated name matches the pattern, where "**" matches any number
+// of path elements.
+func matchGlob(pattern, name string) bool {
+	return matchElements(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchElements(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := range len(name) + 1 {
+			if matchElements(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], name[0])
+	return ok && matchElements(pattern[1:], name[1:])
+}
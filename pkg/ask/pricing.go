@@ -0,0 +1,101 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Estimation of the cost of the requests from the list prices of the models.
+
+package ask
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/maruel/genai"
+)
+
+// Price is the list price of a model in US dollars per million tokens.
+type Price struct {
+	Input       float64
+	CachedInput float64
+	Output      float64
+}
+
+// Prices are the list prices of the popular models, keyed by their model ID without the date or version
+// suffix. They are updated by hand and may be stale; the providers' pricing pages are authoritative.
+var Prices = map[string]Price{
+	// https://docs.anthropic.com/en/docs/about-claude/pricing
+	"claude-opus-4-5":   {Input: 5, CachedInput: 0.5, Output: 25},
+	"claude-opus-4-1":   {Input: 15, CachedInput: 1.5, Output: 75},
+	"claude-opus-4":     {Input: 15, CachedInput: 1.5, Output: 75},
+	"claude-sonnet-4-5": {Input: 3, CachedInput: 0.3, Output: 15},
+	"claude-sonnet-4":   {Input: 3, CachedInput: 0.3, Output: 15},
+	"claude-3-7-sonnet": {Input: 3, CachedInput: 0.3, Output: 15},
+	"claude-haiku-4-5":  {Input: 1, CachedInput: 0.1, Output: 5},
+	"claude-3-5-haiku":  {Input: 0.8, CachedInput: 0.08, Output: 4},
+	// https://platform.openai.com/docs/pricing
+	"gpt-5":        {Input: 1.25, CachedInput: 0.125, Output: 10},
+	"gpt-5-mini":   {Input: 0.25, CachedInput: 0.025, Output: 2},
+	"gpt-5-nano":   {Input: 0.05, CachedInput: 0.005, Output: 0.4},
+	"gpt-4.1":      {Input: 2, CachedInput: 0.5, Output: 8},
+	"gpt-4.1-mini": {Input: 0.4, CachedInput: 0.1, Output: 1.6},
+	"gpt-4.1-nano": {Input: 0.1, CachedInput: 0.025, Output: 0.4},
+	"gpt-4o":       {Input: 2.5, CachedInput: 1.25, Output: 10},
+	"gpt-4o-mini":  {Input: 0.15, CachedInput: 0.075, Output: 0.6},
+	"o3":           {Input: 2, CachedInput: 0.5, Output: 8},
+	"o3-mini":      {Input: 1.1, CachedInput: 0.55, Output: 4.4},
+	"o4-mini":      {Input: 1.1, CachedInput: 0.275, Output: 4.4},
+	// https://ai.google.dev/gemini-api/docs/pricing, for prompts up to 200k tokens.
+	"gemini-2.5-pro":        {Input: 1.25, CachedInput: 0.31, Output: 10},
+	"gemini-2.5-flash":      {Input: 0.3, CachedInput: 0.075, Output: 2.5},
+	"gemini-2.5-flash-lite": {Input: 0.1, CachedInput: 0.025, Output: 0.4},
+	"gemini-2.0-flash":      {Input: 0.1, CachedInput: 0.025, Output: 0.4},
+	"gemini-2.0-flash-lite": {Input: 0.075, CachedInput: 0.075, Output: 0.3},
+	// https://api-docs.deepseek.com/quick_start/pricing
+	"deepseek-chat":     {Input: 0.27, CachedInput: 0.07, Output: 1.1},
+	"deepseek-reasoner": {Input: 0.55, CachedInput: 0.14, Output: 2.19},
+	// https://mistral.ai/pricing#api-pricing
+	"mistral-large":  {Input: 2, CachedInput: 2, Output: 6},
+	"mistral-medium": {Input: 0.4, CachedInput: 0.4, Output: 2},
+	"mistral-small":  {Input: 0.1, CachedInput: 0.1, Output: 0.3},
+	// https://docs.x.ai/docs/models
+	"grok-4":      {Input: 3, CachedInput: 0.75, Output: 15},
+	"grok-3":      {Input: 3, CachedInput: 0.75, Output: 15},
+	"grok-3-mini": {Input: 0.3, CachedInput: 0.075, Output: 0.5},
+}
+
+// reVersionSuffix matches the date or version suffixes of the model IDs of a same model, e.g.
+// "-20250514", "-2024-08-06", "-0709", "-001", "-latest" or "-preview-09-2025".
+var reVersionSuffix = regexp.MustCompile(`^(-\d{8}|-\d{4}-\d{2}-\d{2}|-\d{3,4}|-latest|-preview(-\d{2}-\d{4})?)?$`)
+
+// LookupPrice returns the price of the model from Prices, matching the model ID exactly or with a date or
+// version suffix. The organization prefix of routers, e.g. "anthropic/" for openrouter, is ignored.
+//
+// Other variants, e.g. "o3-pro" for "o3", are unknown since their price usually differs.
+func LookupPrice(model string) (Price, bool) {
+	if i := strings.LastIndexByte(model, '/'); i >= 0 {
+		model = model[i+1:]
+	}
+	for k, p := range Prices {
+		if rest, ok := strings.CutPrefix(model, k); ok && reVersionSuffix.MatchString(rest) {
+			return p, true
+		}
+	}
+	return Price{}, false
+}
+
+// Cost returns the estimated cost in US dollars of the usage of a request to the model, or false if the
+// price of the model is unknown.
+func Cost(model string, u *genai.Usage) (float64, bool) {
+	p, ok := LookupPrice(model)
+	if !ok {
+		return 0, false
+	}
+	// Some providers, e.g. anthropic, exclude the cached tokens from the input tokens and others include them,
+	// so derive the uncached input tokens from the total when set.
+	in := u.InputTokens - u.InputCachedTokens
+	if u.TotalTokens != 0 {
+		in = u.TotalTokens - u.OutputTokens - u.InputCachedTokens
+	}
+	in = max(in, 0)
+	return (float64(in)*p.Input + float64(u.InputCachedTokens)*p.CachedInput + float64(u.OutputTokens)*p.Output) / 1e6, true
+}
@@ -0,0 +1,45 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Tests of the matching of the model IDs to their price.
+
+package ask
+
+import "testing"
+
+func TestLookupPrice(t *testing.T) {
+	data := []struct {
+		model string
+		want  string
+	}{
+		{"o3", "o3"},
+		{"o3-2025-04-16", "o3"},
+		{"o3-mini", "o3-mini"},
+		{"o3-pro", ""},
+		{"gpt-4o-mini", "gpt-4o-mini"},
+		{"openai/gpt-4o-2024-08-06", "gpt-4o"},
+		{"claude-sonnet-4-20250514", "claude-sonnet-4"},
+		{"claude-sonnet-4-5-20250929", "claude-sonnet-4-5"},
+		{"claude-opus-4-7", ""},
+		{"gemini-2.0-flash-001", "gemini-2.0-flash"},
+		{"gemini-2.5-flash-preview-09-2025", "gemini-2.5-flash"},
+		{"mistral-large-latest", "mistral-large"},
+		{"grok-4-0709", "grok-4"},
+		{"unknown", ""},
+	}
+	for _, l := range data {
+		t.Run(l.model, func(t *testing.T) {
+			got, ok := LookupPrice(l.model)
+			if l.want == "" {
+				if ok {
+					t.Fatalf("got %v, want unknown", got)
+				}
+				return
+			}
+			if !ok || got != Prices[l.want] {
+				t.Fatalf("got %v, %t, want %v", got, ok, Prices[l.want])
+			}
+		})
+	}
+}
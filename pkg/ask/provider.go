@@ -0,0 +1,120 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Provider loading, selecting the first available one when none is specified.
+
+package ask
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/maruel/genai"
+	"github.com/maruel/genai/adapters"
+	"github.com/maruel/genai/providers"
+)
+
+// LoadProvider connects to a provider.
+//
+// When provider is empty, the first available provider is used, preferring the CLI based ones. Options that
+// do not apply to the provider kind are ignored.
+func LoadProvider(ctx context.Context, provider string, opts ...genai.ProviderOption) (genai.Provider, error) {
+	if provider == "" {
+		provs := providers.Available(ctx)
+		if len(provs) == 0 {
+			return nil, errors.New("no providers available, make sure to set an FOO_API_KEY env var or install pi/codex/opencode/claude")
+		}
+		// If there's only one, use it directly.
+		if len(provs) == 1 {
+			for name, cfg := range provs {
+				c, err := cfg.Factory(ctx, filterOpts(cfg.IsCLI, opts)...)
+				if err != nil {
+					return nil, fmt.Errorf("failed to connect to provider %q: %w", name, err)
+				}
+				return adapters.WrapReasoning(c), nil
+			}
+		}
+		for _, name := range autoOrder(slices.Collect(maps.Keys(provs))) {
+			cfg := provs[name]
+			c, err := cfg.Factory(ctx, filterOpts(cfg.IsCLI, opts)...)
+			if err != nil {
+				slog.Debug("provider skipped", "provider", name, "error", err)
+				continue
+			}
+			return adapters.WrapReasoning(c), nil
+		}
+		return nil, errors.New("no providers could be loaded with the given options")
+	}
+	cfg := providers.All[provider]
+	if cfg.Factory == nil {
+		return nil, fmt.Errorf("unknown provider %q", provider)
+	}
+	c, err := cfg.Factory(ctx, filterOpts(cfg.IsCLI, opts)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to provider %q: %w", provider, err)
+	}
+	return adapters.WrapReasoning(c), nil
+}
+
+// AutoOrder returns the available providers in the order LoadProvider tries them when no provider is
+// specified.
+func AutoOrder(ctx context.Context) []string {
+	return autoOrder(slices.Collect(maps.Keys(providers.Available(ctx))))
+}
+
+// autoOrder sorts the provider names, preferring CLI-based providers, then alphabetically.
+func autoOrder(names []string) []string {
+	out := make([]string, 0, len(names))
+	for _, name := range []string{"pi", "codex", "opencode", "claudecode"} {
+		if slices.Contains(names, name) {
+			out = append(out, name)
+		}
+	}
+	for _, name := range slices.Sorted(slices.Values(names)) {
+		if !slices.Contains(out, name) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// filterOpts returns opts appropriate for the provider kind.
+// CLI providers use ProviderOptionStarterWrapper; HTTP providers use ProviderOptionTransportWrapper.
+func filterOpts(isCLI bool, opts []genai.ProviderOption) []genai.ProviderOption {
+	out := make([]genai.ProviderOption, 0, len(opts))
+	for _, o := range opts {
+		switch o.(type) {
+		case genai.ProviderOptionTransportWrapper:
+			if isCLI {
+				continue
+			}
+		case genai.ProviderOptionStarterWrapper:
+			if !isCLI {
+				continue
+			}
+		}
+		out = append(out, o)
+	}
+	return out
+}
+
+// SupportsWebSearch returns true when the provider's scoreboard lists its own web search for the current
+// model.
+func SupportsWebSearch(c genai.Provider) bool {
+	sb := c.Scoreboard()
+	for i := range sb.Scenarios {
+		sc := &sb.Scenarios[i]
+		if !slices.Contains(sc.Models, c.ModelID()) {
+			continue
+		}
+		if (sc.GenSync != nil && sc.GenSync.WebSearch) || (sc.GenStream != nil && sc.GenStream.WebSearch) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Redaction of the secrets in the text documents before they are sent.
+
+package ask
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/maruel/genai"
+)
+
+// RedactPlaceholder replaces each match of the redaction patterns.
+const RedactPlaceholder = "[REDACTED]"
+
+// RedactPatterns are sensible default patterns for Options.Redact: API keys, tokens, private keys and email
+// addresses.
+var RedactPatterns = []*regexp.Regexp{
+	// Private keys in PEM format.
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+	// AWS access key IDs.
+	regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`),
+	// GitHub tokens.
+	regexp.MustCompile(`\b(gh[opsur]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`),
+	// Google API keys.
+	regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),
+	// Slack tokens.
+	regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`),
+	// OpenAI, Anthropic and similar "sk-" keys.
+	regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}\b`),
+	// JSON Web Tokens.
+	regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\b`),
+	// Bearer tokens in HTTP headers.
+	regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/-]{20,}=*`),
+	// Email addresses.
+	regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`),
+}
+
+// redactDoc returns the document with the matches of the patterns replaced with RedactPlaceholder.
+//
+// Binary documents, e.g. images or PDFs, are returned as is.
+func redactDoc(ctx context.Context, d genai.Doc, patterns []*regexp.Regexp) (genai.Doc, error) {
+	b, err := io.ReadAll(d.Src)
+	if err != nil {
+		return d, err
+	}
+	name := d.GetFilename()
+	if !utf8.Valid(b) || bytes.IndexByte(b, 0) >= 0 {
+		return genai.Doc{Filename: name, Src: bytes.NewReader(b)}, nil
+	}
+	s := string(b)
+	count := 0
+	for _, re := range patterns {
+		s = re.ReplaceAllStringFunc(s, func(string) string {
+			count++
+			return RedactPlaceholder
+		})
+	}
+	slog.DebugContext(ctx, "redact", "doc", name, "count", count)
+	return genai.Doc{Filename: name, Src: strings.NewReader(s)}, nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Detection of the refusals for Options.RetryRefusal.
+
+package ask
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/maruel/genai"
+)
+
+// refusalRetryPrompt is appended to the system prompt when retrying after a refusal.
+const refusalRetryPrompt = "The request is legitimate. Reply factually and neutrally to it. If part of it cannot be answered, answer the rest and briefly say what was left out."
+
+// refusalPrefixes are the starts of the usual refusals, in lower case.
+var refusalPrefixes = []string{
+	"i can't assist",
+	"i can't help",
+	"i can't provide",
+	"i cannot assist",
+	"i cannot help",
+	"i cannot provide",
+	"i'm not able to help",
+	"i'm sorry, but i can't",
+	"i'm sorry, but i cannot",
+	"i am sorry, but i cannot",
+	"i'm unable to help",
+	"i won't be able to help",
+	"sorry, i can't",
+	"sorry, but i can't",
+}
+
+// maxRefusalLen is the length of a text reply above which it is not considered a refusal, so that an answer
+// starting with a caveat is kept.
+const maxRefusalLen = 400
+
+// isRefusal returns true if the reply was stopped by the content filter or is a short text looking like a
+// refusal.
+//
+// The detection is conservative: it is only based on the start of the reply.
+func isRefusal(res *Result) bool {
+	if res.Usage.FinishReason == genai.FinishedContentFilter {
+		return true
+	}
+	t := strings.TrimSpace(res.String())
+	if t == "" || len(t) > maxRefusalLen {
+		return false
+	}
+	t = strings.ToLower(strings.ReplaceAll(t, "’", "'"))
+	for _, p := range refusalPrefixes {
+		if strings.HasPrefix(t, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// withSystemPrompt returns a copy of opts with the system prompt replaced.
+func withSystemPrompt(opts []genai.GenOption, sp string) []genai.GenOption {
+	out := slices.Clone(opts)
+	for i, o := range out {
+		if t, ok := o.(*genai.GenOptionText); ok {
+			c := *t
+			c.SystemPrompt = sp
+			out[i] = &c
+			return out
+		}
+	}
+	return append(out, &genai.GenOptionText{SystemPrompt: sp})
+}
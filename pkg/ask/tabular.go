@@ -0,0 +1,321 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Conversion of the spreadsheets to markdown tables for Options.Tabular.
+
+package ask
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultTabularMaxRows is the number of rows of a spreadsheet sent when Options.TabularMaxRows is 0.
+const DefaultTabularMaxRows = 500
+
+// isTabular returns true if the file is a spreadsheet converted with Options.Tabular.
+func isTabular(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv", ".tsv", ".xlsx":
+		return true
+	default:
+		return false
+	}
+}
+
+// readTabular returns the spreadsheet as a markdown table, with at most maxRows rows after the header.
+//
+// sheet selects the sheet of a xlsx file; the first one is used when empty. The second return value is the
+// number of rows dropped.
+func readTabular(name, sheet string, maxRows int) (string, int, error) {
+	var rows [][]string
+	var title string
+	var err error
+	dropped := 0
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".xlsx":
+		var sheets []string
+		if rows, dropped, sheets, title, err = readXLSX(name, sheet, maxRows); err != nil {
+			return "", 0, err
+		}
+		if len(sheets) > 1 {
+			title = fmt.Sprintf("sheet %q (the workbook has the sheets %s)", title, strings.Join(quoteAll(sheets), ", "))
+		} else {
+			title = fmt.Sprintf("sheet %q", title)
+		}
+	default:
+		if sheet != "" {
+			return "", 0, fmt.Errorf("%s: a sheet can only be selected in a xlsx file", name)
+		}
+		if rows, err = readCSV(name); err != nil {
+			return "", 0, err
+		}
+	}
+	if len(rows) > maxRows+1 {
+		dropped = len(rows) - maxRows - 1
+		rows = rows[:maxRows+1]
+	}
+	var b strings.Builder
+	b.WriteString(filepath.Base(name))
+	if title != "" {
+		b.WriteString(", " + title)
+	}
+	b.WriteString(":\n\n")
+	writeMarkdownTable(&b, rows)
+	if dropped != 0 {
+		fmt.Fprintf(&b, "\n(%d more rows were truncated)\n", dropped)
+	}
+	return b.String(), dropped, nil
+}
+
+// readCSV returns the records of a CSV file, or a TSV one based on its extension.
+func readCSV(name string) ([][]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	if strings.EqualFold(filepath.Ext(name), ".tsv") {
+		r.Comma = '\t'
+	}
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return rows, nil
+}
+
+// writeMarkdownTable writes rows as a markdown table, the first row being the header.
+func writeMarkdownTable(b *strings.Builder, rows [][]string) {
+	if len(rows) == 0 {
+		b.WriteString("(empty)\n")
+		return
+	}
+	cols := 0
+	for _, r := range rows {
+		cols = max(cols, len(r))
+	}
+	cell := strings.NewReplacer("|", `\|`, "\r\n", " ", "\n", " ")
+	for i, r := range rows {
+		b.WriteString("|")
+		for j := range cols {
+			v := ""
+			if j < len(r) {
+				v = cell.Replace(strings.TrimSpace(r[j]))
+			}
+			b.WriteString(" " + v + " |")
+		}
+		b.WriteString("\n")
+		if i == 0 {
+			b.WriteString(strings.Repeat("| --- ", cols) + "|\n")
+		}
+	}
+}
+
+// xlsxWorkbook is xl/workbook.xml.
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		// ID is the r:id attribute, referencing the relationships.
+		ID string `xml:"id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+// xlsxRels is xl/_rels/workbook.xml.rels.
+type xlsxRels struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText is a rich text element, used for both the shared strings and the inline strings.
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (x *xlsxText) String() string {
+	if len(x.Runs) == 0 {
+		return x.T
+	}
+	var b strings.Builder
+	for _, r := range x.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+// maxXLSXColumns is the number of columns of an Excel sheet.
+const maxXLSXColumns = 16384
+
+// xlsxSST is xl/sharedStrings.xml.
+type xlsxSST struct {
+	Items []xlsxText `xml:"si"`
+}
+
+// xlsxSheet is a worksheet.
+type xlsxSheet struct {
+	Rows []struct {
+		// Ref is the 1 based row number.
+		Ref   int `xml:"r,attr"`
+		Cells []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSX returns at most maxRows rows after the header of a sheet of a xlsx file, the number of rows
+// dropped, the names of all the sheets and the name of the sheet read.
+//
+// The formulas are replaced with their cached values. The numbers are not formatted, so dates are serial
+// numbers.
+func readXLSX(name, sheet string, maxRows int) ([][]string, int, []string, string, error) {
+	z, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, 0, nil, "", fmt.Errorf("%s: %w", name, err)
+	}
+	defer func() { _ = z.Close() }()
+	var wb xlsxWorkbook
+	if err := readZipXML(&z.Reader, "xl/workbook.xml", &wb); err != nil {
+		return nil, 0, nil, "", fmt.Errorf("%s: %w", name, err)
+	}
+	var rels xlsxRels
+	if err := readZipXML(&z.Reader, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, 0, nil, "", fmt.Errorf("%s: %w", name, err)
+	}
+	var sst xlsxSST
+	// Workbooks without any string have no shared strings.
+	if err := readZipXML(&z.Reader, "xl/sharedStrings.xml", &sst); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, 0, nil, "", fmt.Errorf("%s: %w", name, err)
+	}
+	if len(wb.Sheets) == 0 {
+		return nil, 0, nil, "", fmt.Errorf("%s: no sheet", name)
+	}
+	names := make([]string, len(wb.Sheets))
+	idx := -1
+	for i := range wb.Sheets {
+		names[i] = wb.Sheets[i].Name
+		if idx == -1 && (sheet == "" || sheet == names[i]) {
+			idx = i
+		}
+	}
+	if idx == -1 {
+		return nil, 0, nil, "", fmt.Errorf("%s: no sheet %q; the sheets are %s", name, sheet, strings.Join(quoteAll(names), ", "))
+	}
+	target := ""
+	for _, r := range rels.Relationships {
+		if r.ID == wb.Sheets[idx].ID {
+			target = r.Target
+		}
+	}
+	if target == "" {
+		return nil, 0, nil, "", fmt.Errorf("%s: sheet %q has no content", name, names[idx])
+	}
+	// The target is relative to xl/ unless absolute.
+	if t, ok := strings.CutPrefix(target, "/"); ok {
+		target = t
+	} else {
+		target = path.Join("xl", target)
+	}
+	var ws xlsxSheet
+	if err := readZipXML(&z.Reader, target, &ws); err != nil {
+		return nil, 0, nil, "", fmt.Errorf("%s: %w", name, err)
+	}
+	limit := maxRows + 1
+	rows := make([][]string, 0, min(len(ws.Rows), limit))
+	// n is the number of rows, including the ones skipped.
+	n := 0
+	for _, r := range ws.Rows {
+		// Rows may be skipped when empty. The row number comes from the file, so the gap is only filled up to
+		// the limit.
+		if r.Ref > n+1 {
+			for len(rows) < min(r.Ref-1, limit) {
+				rows = append(rows, nil)
+			}
+			n = r.Ref - 1
+		}
+		n++
+		if len(rows) >= limit {
+			continue
+		}
+		var row []string
+		for _, c := range r.Cells {
+			v := c.Value
+			switch c.Type {
+			case "s":
+				i, err := strconv.Atoi(v)
+				if err != nil || i < 0 || i >= len(sst.Items) {
+					return nil, 0, nil, "", fmt.Errorf("%s: cell %s: invalid shared string %q", name, c.Ref, v)
+				}
+				v = sst.Items[i].String()
+			case "inlineStr":
+				v = c.Inline.String()
+			case "b":
+				v = strconv.FormatBool(v == "1")
+			}
+			// Cells may be skipped when empty.
+			if col := columnIndex(c.Ref); col > len(row) {
+				row = append(row, make([]string, col-len(row))...)
+			}
+			row = append(row, v)
+		}
+		rows = append(rows, row)
+	}
+	return rows, n - len(rows), names, names[idx], nil
+}
+
+// readZipXML decodes the XML file n in the zip archive.
+func readZipXML(z *zip.Reader, n string, v any) error {
+	f, err := z.Open(n)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	if err := xml.NewDecoder(io.LimitReader(f, 256<<20)).Decode(v); err != nil {
+		return fmt.Errorf("%s: %w", n, err)
+	}
+	return nil
+}
+
+// columnIndex returns the 0 based column of a cell reference like "AB12", or -1 if invalid or beyond the
+// last column of Excel, XFD.
+func columnIndex(ref string) int {
+	col := 0
+	i := 0
+	for ; i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z'; i++ {
+		if col = col*26 + int(ref[i]-'A'+1); col > maxXLSXColumns {
+			return -1
+		}
+	}
+	if i == 0 {
+		return -1
+	}
+	return col - 1
+}
+
+func quoteAll(s []string) []string {
+	out := make([]string, len(s))
+	for i, v := range s {
+		out[i] = strconv.Quote(v)
+	}
+	return out
+}
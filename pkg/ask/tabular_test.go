@@ -0,0 +1,72 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Tests of the spreadsheets conversion to markdown tables.
+
+package ask
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadTabularXLSXRowGap(t *testing.T) {
+	// A crafted row number must not allocate the rows in between.
+	sheet := `<worksheet><sheetData>` +
+		`<row r="1"><c r="A1" t="inlineStr"><is><t>name</t></is></c></row>` +
+		`<row r="3"><c r="A3" t="inlineStr"><is><t>a</t></is></c></row>` +
+		`<row r="2000000000"><c r="A2000000000" t="inlineStr"><is><t>b</t></is></c></row>` +
+		`<row r="2000000001"><c r="ZZZZZZZZZZZZZZ2000000001" t="inlineStr"><is><t>c</t></is></c></row>` +
+		`</sheetData></worksheet>`
+	name := writeXLSX(t, sheet)
+	got, dropped, err := readTabular(name, "", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 2000000001 - 4; dropped != want {
+		t.Fatalf("dropped %d, want %d", dropped, want)
+	}
+	for _, s := range []string{"| name |", "| a |"} {
+		if !strings.Contains(got, s) {
+			t.Fatalf("missing %q in:\n%s", s, got)
+		}
+	}
+	if strings.Contains(got, "| b |") {
+		t.Fatalf("unexpected row b in:\n%s", got)
+	}
+}
+
+// writeXLSX writes a workbook with a single sheet and returns its path.
+func writeXLSX(t *testing.T, sheet string) string {
+	name := filepath.Join(t.TempDir(), "book.xlsx")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z := zip.NewWriter(f)
+	files := map[string]string{
+		"xl/workbook.xml":            `<workbook><sheets><sheet name="Sheet1" r:id="rId1" xmlns:r="r"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships><Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/worksheets/sheet1.xml":   sheet,
+	}
+	for n, c := range files {
+		w, err := z.Create(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(c)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
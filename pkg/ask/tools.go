@@ -0,0 +1,219 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Tools made available to the model in addition to the sandboxed shell.
+
+package ask
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/maruel/genai"
+)
+
+const (
+	// maxWriteFileSize is the maximum size of a single file written by the write_file tool.
+	maxWriteFileSize = 1 << 20
+	// maxWriteTotalSize is the maximum cumulative size written by the write_file tool in one run.
+	maxWriteTotalSize = 10 << 20
+)
+
+// writeFileArguments is the write_file tool argument.
+type writeFileArguments struct {
+	Path    string `json:"path" jsonschema_description:"Relative path of the file to write, using forward slashes"`
+	Content string `json:"content" jsonschema_description:"Full content of the file"`
+}
+
+// newWriteFileTool returns a tool that lets the model write files under outDir.
+//
+// Paths escaping outDir, including via symlinks, are refused. Existing files are only overwritten when
+// force is true. The returned root must be closed once the tool is not needed anymore.
+func newWriteFileTool(outDir string, force bool) (genai.ToolDef, *os.Root, error) {
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return genai.ToolDef{}, nil, err
+	}
+	root, err := os.OpenRoot(outDir)
+	if err != nil {
+		return genai.ToolDef{}, nil, err
+	}
+	var mu sync.Mutex
+	total := 0
+	t := genai.ToolDef{
+		Name:        "write_file",
+		Description: "Writes content to a file in the output directory and returns the path written. Parent directories are created as needed.",
+		Callback: func(ctx context.Context, args *writeFileArguments) (string, error) {
+			// Policy refusals are returned to the model so it can adjust; only I/O failures abort the run.
+			p := path.Clean(args.Path)
+			if !filepath.IsLocal(p) {
+				return fmt.Sprintf("refused: %q is not a relative path within the output directory", args.Path), nil
+			}
+			if len(args.Content) > maxWriteFileSize {
+				return fmt.Sprintf("refused: content is %d bytes, the limit is %d bytes", len(args.Content), maxWriteFileSize), nil
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if total+len(args.Content) > maxWriteTotalSize {
+				return fmt.Sprintf("refused: the limit of %d bytes written in total was reached", maxWriteTotalSize), nil
+			}
+			if d := path.Dir(p); d != "." {
+				if err := root.MkdirAll(d, 0o755); err != nil {
+					return "", err
+				}
+			}
+			flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+			if force {
+				flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+			}
+			f, err := root.OpenFile(p, flags, 0o644)
+			if errors.Is(err, fs.ErrExist) {
+				return fmt.Sprintf("refused: %q already exists", args.Path), nil
+			}
+			if err != nil {
+				return "", err
+			}
+			_, err = f.WriteString(args.Content)
+			if err2 := f.Close(); err == nil {
+				err = err2
+			}
+			if err != nil {
+				return "", err
+			}
+			total += len(args.Content)
+			out := filepath.Join(outDir, filepath.FromSlash(p))
+			slog.DebugContext(ctx, "write_file", "path", out, "size", len(args.Content))
+			return out, nil
+		},
+	}
+	return t, root, nil
+}
+
+// privateTempDir is a temporary directory only accessible by the current user.
+type privateTempDir string
+
+// UsePrivateTempDir creates a private temporary directory and makes it the process' temporary directory.
+// Close deletes it.
+//
+// The shell tool writes the scripts to run in the temporary directory. On multi-user machines, the system one
+// is shared, which lets other users read the scripts or swap them before they are run. The environment
+// variables are inherited by the scripts.
+//
+// It changes the environment of the process, so it must be called once at startup, before any Run.
+func UsePrivateTempDir() (io.Closer, error) {
+	// MkdirTemp creates the directory with mode 0o700.
+	d, err := os.MkdirTemp("", "ask-")
+	if err != nil {
+		return nil, err
+	}
+	// os.TempDir() uses TMPDIR on unix and TMP/TEMP on Windows.
+	for _, k := range []string{"TMPDIR", "TMP", "TEMP"} {
+		if err = os.Setenv(k, d); err != nil {
+			_ = os.Remove(d)
+			return nil, err
+		}
+	}
+	return privateTempDir(d), nil
+}
+
+// Close deletes the directory and its content.
+func (p privateTempDir) Close() error {
+	return os.RemoveAll(string(p))
+}
+
+// ToolError is returned by Run when a tool fails, as opposed to the provider.
+type ToolError struct {
+	Name string
+	Err  error
+}
+
+func (e *ToolError) Error() string {
+	return fmt.Sprintf("tool %s: %s", e.Name, e.Err)
+}
+
+func (e *ToolError) Unwrap() error {
+	return e.Err
+}
+
+// wrapTools returns a copy of tools where onCall is called before each callback and onResult after it returns.
+//
+// Either can be nil. The callbacks are not run once the context is canceled. A command exiting with an error
+// is returned to the model as part of the output, unless abort is true. Other errors are returned as a
+// *ToolError, which aborts the request.
+func wrapTools(tools []genai.ToolDef, abort bool, onCall func(name, args string), onResult func(name, out string, err error)) []genai.ToolDef {
+	out := make([]genai.ToolDef, len(tools))
+	for i := range tools {
+		out[i] = tools[i]
+		name := tools[i].Name
+		fn := reflect.ValueOf(tools[i].Callback)
+		// Keep the exact function type since the input schema is derived from it.
+		out[i].Callback = reflect.MakeFunc(fn.Type(), func(args []reflect.Value) []reflect.Value {
+			ctx, _ := args[0].Interface().(context.Context)
+			if err := ctx.Err(); err != nil {
+				return []reflect.Value{reflect.ValueOf(""), reflect.ValueOf(&err).Elem()}
+			}
+			b, _ := json.Marshal(args[1].Interface())
+			if onCall != nil {
+				onCall(name, string(b))
+			}
+			stop := heartbeat(ctx, name, string(b))
+			res := fn.Call(args)
+			stop()
+			s := res[0].String()
+			err, _ := res[1].Interface().(error)
+			var exitErr *exec.ExitError
+			if !abort && errors.As(err, &exitErr) {
+				// A command failing is an answer, e.g. grep not finding a match.
+				s += "\n" + err.Error()
+				err = nil
+			}
+			if onResult != nil && ctx.Err() == nil {
+				onResult(name, s, err)
+			}
+			if err != nil && ctx.Err() == nil {
+				err = &ToolError{Name: name, Err: err}
+			}
+			return []reflect.Value{reflect.ValueOf(s), reflect.ValueOf(&err).Elem()}
+		}).Interface()
+	}
+	return out
+}
+
+// heartbeatInterval is the interval at which a running tool is logged.
+const heartbeatInterval = 10 * time.Second
+
+// heartbeat logs at the info level that the tool is still running every heartbeatInterval, so a slow
+// command, e.g. a build, doesn't look hung. The returned function stops it.
+func heartbeat(ctx context.Context, name, args string) func() {
+	start := time.Now()
+	t := time.NewTicker(heartbeatInterval)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				slog.InfoContext(ctx, "still running", "tool", name, "args", args, "elapsed", time.Since(start).Round(time.Second))
+			}
+		}
+	})
+	return func() {
+		t.Stop()
+		close(done)
+		wg.Wait()
+	}
+}
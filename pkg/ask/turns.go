@@ -0,0 +1,74 @@
+// Copyright 2025 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Limits of the tool call loop, for Options.MaxTurns.
+
+package ask
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"strings"
+
+	"github.com/maruel/genai"
+)
+
+// maxIdenticalToolCalls is the number of times in a row the model can request the same tool calls before the
+// loop is aborted.
+const maxIdenticalToolCalls = 3
+
+// providerTurns wraps a Provider to abort the tool call loop after max requests, or when the model keeps
+// requesting the same tool calls with the same arguments.
+type providerTurns struct {
+	genai.Provider
+	// max is the maximum number of requests; 0 means unlimited.
+	max int
+
+	turns int
+	// last is the tool calls of the previous reply and repeats the number of times in a row it was requested.
+	last    string
+	repeats int
+}
+
+func (c *providerTurns) GenStream(ctx context.Context, msgs genai.Messages, opts ...genai.GenOption) (iter.Seq[genai.Reply], func() (genai.Result, error)) {
+	c.turns++
+	if c.max > 0 && c.turns > c.max {
+		return func(yield func(genai.Reply) bool) {}, func() (genai.Result, error) {
+			return genai.Result{}, fmt.Errorf("reached the maximum of %d turns of tool calls", c.max)
+		}
+	}
+	fragments, finish := c.Provider.GenStream(ctx, msgs, opts...)
+	return fragments, func() (genai.Result, error) {
+		res, err := finish()
+		if err != nil {
+			return res, err
+		}
+		calls := toolCallsKey(&res.Message)
+		if calls == "" || calls != c.last {
+			c.last = calls
+			c.repeats = 1
+			return res, nil
+		}
+		if c.repeats++; c.repeats >= maxIdenticalToolCalls {
+			return res, fmt.Errorf("aborted a loop: the model requested the same tool calls %d times in a row", c.repeats)
+		}
+		return res, nil
+	}
+}
+
+func (c *providerTurns) Unwrap() genai.Provider {
+	return c.Provider
+}
+
+// toolCallsKey returns the names and the arguments of the tool calls of the message, ignoring their IDs.
+func toolCallsKey(m *genai.Message) string {
+	var b strings.Builder
+	for i := range m.Replies {
+		if t := &m.Replies[i].ToolCall; !t.IsZero() {
+			b.WriteString(t.Name + "\x00" + t.Arguments + "\x00")
+		}
+	}
+	return b.String()
+}